@@ -10,13 +10,17 @@ import (
 	"github.com/regr76/timetravel/api/helpers"
 	v1 "github.com/regr76/timetravel/api/v1"
 	v2 "github.com/regr76/timetravel/api/v2"
+	v3 "github.com/regr76/timetravel/api/v3"
+	"github.com/regr76/timetravel/dbutils"
 	"github.com/regr76/timetravel/service"
+	"github.com/regr76/timetravel/storage"
 )
 
 type API struct {
 	router         *mux.Router
 	inMemRecords   service.RecordService
 	persistRecords service.VersionedRecordService
+	typedRecords   service.TypedRecordService
 	db             *sql.DB
 }
 
@@ -37,6 +41,10 @@ func (a *API) PersistentRecords() service.VersionedRecordService {
 	return a.persistRecords
 }
 
+func (a *API) TypedRecords() service.TypedRecordService {
+	return a.typedRecords
+}
+
 // generates all api routes for V1 and adds them to the router
 func (a *API) CreateRoutesV1(routes *mux.Router) {
 	routes.Path("/records/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -50,10 +58,70 @@ func (a *API) CreateRoutesV1(routes *mux.Router) {
 
 // generates all api routes for V2 and adds them to the router
 func (a *API) CreateRoutesV2(routes *mux.Router) {
+	routes.Path("/snapshot").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.Snapshot(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/export").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.Export(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/import").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.ImportRecords(a, w, r)
+	}).Methods("POST")
+
+	routes.Path("/schemas/{type}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.GetSchema(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/schemas/{type}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.RegisterSchema(a, w, r)
+	}).Methods("PUT")
+
+	routes.Path("/schemas/{type}/versions/{version}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.GetSchema(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/checkpoints/{day}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.GetCheckpoint(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/search").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.SearchRecords(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.FindRecords(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records:batch").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.UpdateRecords(a, w, r)
+	}).Methods("POST")
+
 	routes.Path("/records/{id}/list").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		v2.ListRecord(a, w, r)
 	}).Methods("GET")
 
+	routes.Path("/records/{id}/diff").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.DiffVersions(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records/{id}/keys/{key}/history").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.KeyHistory(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records/{id}/verify").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.VerifyRecord(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records/{id}/revert/{version}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.RevertRecord(a, w, r)
+	}).Methods("POST")
+
+	routes.Path("/records/{id}/versions/{version}/proof").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.GetInclusionProof(a, w, r)
+	}).Methods("GET")
+
 	routes.Path("/records/{id}/versions/{version}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		v2.GetVersion(a, w, r)
 	}).Methods("GET")
@@ -65,18 +133,51 @@ func (a *API) CreateRoutesV2(routes *mux.Router) {
 	routes.Path("/records/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		v2.UpdateRecord(a, w, r)
 	}).Methods("POST")
+
+	routes.Path("/records/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v2.DeleteRecord(a, w, r)
+	}).Methods("DELETE")
+}
+
+// generates all api routes for V3 and adds them to the router
+func (a *API) CreateRoutesV3(routes *mux.Router) {
+	routes.Path("/records/{id}/list").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v3.ListRecord(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records/{id}/versions/{version}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v3.GetVersion(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v3.GetRecord(a, w, r)
+	}).Methods("GET")
+
+	routes.Path("/records/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v3.UpdateRecord(a, w, r)
+	}).Methods("POST")
 }
 
+// SetupRouter serves the records stored in the SQLite database.
 func (a *API) SetupRouter(db *sql.DB) *mux.Router {
+	return a.SetupRouterWithStore(dbutils.NewStore(db))
+}
+
+// SetupRouterWithStore serves the records kept by the versioned store.
+func (a *API) SetupRouterWithStore(store storage.Store) *mux.Router {
 	inMemService := service.NewInMemoryRecordService()
-	persistService := service.NewPersistentRecordService(db)
-	api := NewAPI(&inMemService, &persistService, db)
+	persistService := service.NewPersistentRecordService(store)
+	typedService := service.NewPersistentTypedRecordService(store)
+	api := NewAPI(&inMemService, &persistService, a.db)
+	api.typedRecords = &typedService
 
 	apiRoute1 := a.router.PathPrefix("/api/v1").Subrouter()
 	apiRoute2 := a.router.PathPrefix("/api/v2").Subrouter()
+	apiRoute3 := a.router.PathPrefix("/api/v3").Subrouter()
 
 	api.CreateRoutesV1(apiRoute1)
 	api.CreateRoutesV2(apiRoute2)
+	api.CreateRoutesV3(apiRoute3)
 
 	a.router.Path("/health").HandlerFunc(HealthCheckHandler)
 
@@ -2,13 +2,24 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"github.com/regr76/timetravel/dbutils"
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/service"
+	"github.com/regr76/timetravel/storage"
 	"github.com/stretchr/testify/require"
 )
 
@@ -235,8 +246,1908 @@ func Benchmark_POST_Routes_V1(b *testing.B) {
 	require.Equal(b, "{\"id\":33,\"data\":{\"key10000\":\"value10000\"}}\n", rrGet.Body.String())
 }
 
+// forEachStore runs a test of the versioned routes twice: against the SQLite database in the file,
+// and against an in-memory store that touches no disk.
+func forEachStore(t *testing.T, filename string, test func(t *testing.T, router *mux.Router)) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := dbutils.InitDB(filename)
+		require.NoError(t, err)
+		// close and check the error
+		defer func() {
+			if cerr := db.Close(); cerr != nil {
+				log.Printf("db close: %v", cerr)
+			}
+		}()
+
+		test(t, NewAPI(nil, nil, db).SetupRouter(db))
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewAPI(nil, nil, nil).SetupRouterWithStore(storage.NewMemoryStore()))
+	})
+}
+
 func Test_GET_Routes_V2(t *testing.T) {
-	filename := "unit-test.db"
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		tests := []struct {
+			description string
+			path        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Health check",
+				path:        "/health",
+				wantStatus:  http.StatusOK,
+				wantBody:    "{\"ok\":true}\n",
+			},
+			{
+				description: "Get non-existent record",
+				path:        "/api/v2/records/15",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"record of id 15 does not exist\"}\n",
+			},
+			{
+				description: "Get record with negative id",
+				path:        "/api/v2/records/-1",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			},
+			{
+				description: "Invalid id (non-numeric)",
+				path:        "/api/v2/records/abc",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			},
+			{
+				description: "Get non-existent record list",
+				path:        "/api/v2/records/15/list",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"record of id 15 does not exist\"}\n",
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("GET", tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Equal(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_POST_Routes_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		tests := []struct {
+			description string
+			body        string // needed for POST requests only; can be empty for GET requests
+			path        string
+			wantStatus  int
+			PostResBody string
+			GetResBody  string
+		}{
+			{
+				description: "Post to negative id",
+				body:        "{\"key1\":\"value1\",\"key2\":\"222\"}",
+				path:        "/api/v2/records/-11",
+				wantStatus:  http.StatusBadRequest,
+				PostResBody: "{\"error\":\"invalid id; id must be a positive number\"}\n",
+				GetResBody:  "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			},
+			{
+				description: "Post to invalid id (non-numeric)",
+				body:        "{\"key1\":\"value1\",\"key2\":\"222\"}",
+				path:        "/api/v2/records/abc",
+				wantStatus:  http.StatusBadRequest,
+				PostResBody: "{\"error\":\"invalid id; id must be a positive number\"}\n",
+				GetResBody:  "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			},
+			{
+				description: "Post invalid json body",
+				body:        "[{\"key1\":}]",
+				path:        "/api/v2/records/18",
+				wantStatus:  http.StatusBadRequest,
+				PostResBody: "{\"error\":\"invalid input; could not parse json\"}\n",
+				GetResBody:  "{\"error\":\"record of id 18 does not exist\"}\n",
+			},
+			{
+				description: "Post keys and values that need escaping",
+				body:        `{"quo\"te":"back\\slash\nnew line"}`,
+				path:        "/api/v2/records/47",
+				wantStatus:  http.StatusOK,
+				PostResBody: `^\{"id":47,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"quo\\"te":"back\\\\slash\\nnew line"\}\}\n$`,
+				GetResBody:  `^\{"id":47,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"quo\\"te":"back\\\\slash\\nnew line"\}\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				jsonBody := []byte(tc.body)
+				body := bytes.NewBuffer(jsonBody)
+
+				reqPost := httptest.NewRequest("POST", tc.path, body)
+				reqPost.Header.Set("Content-Type", "application/json")
+				rrPost := httptest.NewRecorder()
+				router.ServeHTTP(rrPost, reqPost)
+
+				require.Equal(t, tc.wantStatus, rrPost.Code)
+				require.Regexp(t, tc.PostResBody, rrPost.Body.String())
+
+				// every POST request is followed by a GET request to ensure that the record was actually created
+				// and returns same exact body as the POST request
+				reqGet := httptest.NewRequest("GET", tc.path, nil)
+				rrGet := httptest.NewRecorder()
+				router.ServeHTTP(rrGet, reqGet)
+
+				require.Equal(t, tc.wantStatus, rrGet.Code)
+				require.Regexp(t, tc.GetResBody, rrGet.Body.String())
+			})
+		}
+	})
+}
+
+func Test_ListVersions_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		tests := []struct {
+			description string
+			body        string
+			path        string
+			PostStatus  int
+			GetStatus   int
+			PostResBody string
+			GetResBody  string
+		}{
+			{
+				description: "Post new record",
+				body:        "{\"key1\":\"value1\",\"key2\":\"222\",\"status\":null}",
+				path:        "/api/v2/records/1",
+				PostStatus:  http.StatusOK,
+				GetStatus:   http.StatusOK,
+				PostResBody: `^\{"id":1,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"key1":"value1","key2":"222"\}\}\n$`,
+				GetResBody:  `^\{"id":1,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"key1":"value1","key2":"222"\}\}\n$`,
+			},
+			{
+				description: "Update existing record",
+				body:        "{\"key1\":\"value2\",\"status\":\"ok\"}",
+				path:        "/api/v2/records/1",
+				PostStatus:  http.StatusOK,
+				GetStatus:   http.StatusOK,
+				PostResBody: `^\{"id":1,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"key1":"value2","key2":"222","status":"ok"\}\}\n$`,
+				GetResBody:  `^\{"id":1,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"key1":"value2","key2":"222","status":"ok"\}\}\n$`,
+			},
+			{
+				description: "list all existing versions of a record",
+				body:        "{}",
+				path:        "/api/v2/records/1/list",
+				PostStatus:  http.StatusMethodNotAllowed,
+				GetStatus:   http.StatusOK,
+				PostResBody: `^.*$`, // POST request to list endpoint is not be allowed, so response body can be anything
+				GetResBody:  `{"records":\[{"id":1,"version":[\s\S]*`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				jsonBody := []byte(tc.body)
+				body := bytes.NewBuffer(jsonBody)
+
+				reqPost := httptest.NewRequest("POST", tc.path, body)
+				reqPost.Header.Set("Content-Type", "application/json")
+				rrPost := httptest.NewRecorder()
+				router.ServeHTTP(rrPost, reqPost)
+
+				require.Equal(t, tc.PostStatus, rrPost.Code)
+				require.Regexp(t, tc.PostResBody, rrPost.Body.String())
+
+				// every POST request is followed by a GET request to same path
+				reqGet := httptest.NewRequest("GET", tc.path, nil)
+				rrGet := httptest.NewRecorder()
+				router.ServeHTTP(rrGet, reqGet)
+
+				require.Equal(t, tc.GetStatus, rrGet.Code)
+				require.Regexp(t, tc.GetResBody, rrGet.Body.String())
+			})
+		}
+	})
+}
+
+func Test_GetRecordAt_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		reqPost := httptest.NewRequest("POST", "/api/v2/records/42", bytes.NewBuffer([]byte("{\"limit\":\"1000\"}")))
+		reqPost.Header.Set("Content-Type", "application/json")
+		rrPost := httptest.NewRecorder()
+		router.ServeHTTP(rrPost, reqPost)
+		require.Equal(t, http.StatusOK, rrPost.Code)
+
+		future := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+
+		tests := []struct {
+			description string
+			path        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Get record before it existed",
+				path:        "/api/v2/records/42?at=1999-01-01T00:00:00Z",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"record of id 42 does not exist at 1999-01-01T00:00:00Z"\}\n$`,
+			},
+			{
+				description: "Get record at a time after the latest update",
+				path:        "/api/v2/records/42?at=" + future,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":42,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"limit":"1000"\}\}\n$`,
+			},
+			{
+				description: "Get record with invalid timestamp",
+				path:        "/api/v2/records/42?at=yesterday",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid at; at must be an RFC3339 timestamp"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("GET", tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_GetRecord_V2_StoreFailure(t *testing.T) {
+	// the database is closed under the router, so this test uses its own
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	router := NewAPI(nil, nil, db).SetupRouter(db)
+	require.NoError(t, db.Close())
+
+	// a failing store is an internal error, not a record that does not exist
+	for _, path := range []string{
+		"/api/v2/records/1",
+		"/api/v2/records/1?at=2026-01-01T00:00:00Z",
+		"/api/v2/records/1?known_at=2026-01-01T00:00:00Z&valid_at=2026-01-01T00:00:00Z",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code, path)
+		require.Equal(t, "{\"error\":\"internal error\"}\n", rr.Body.String(), path)
+	}
+}
+
+func Test_UpdateRecords_V2_StoreFailure(t *testing.T) {
+	// the database is closed under the router, so this test uses its own
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	router := NewAPI(nil, nil, db).SetupRouter(db)
+	require.NoError(t, db.Close())
+
+	// the outcome of every update is reported along with the error
+	req := httptest.NewRequest("POST", "/api/v2/records:batch?atomic=false", bytes.NewBuffer([]byte(`[{"id":1,"data":{"a":"1"}},{"id":2,"data":{"a":"2"}}]`)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, `{"atomic":false,"updated":0,"failed":2,"results":[`+
+		`{"index":0,"id":1,"error":"not applied; the batch stopped on an internal error"},`+
+		`{"index":1,"id":2,"error":"not applied; the batch stopped on an internal error"}],"error":"internal error"}`+"\n", rr.Body.String())
+}
+
+func Test_Bitemporal_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		future := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+
+		tests := []struct {
+			description string
+			method      string
+			body        string
+			path        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Post current workforce",
+				method:      "POST",
+				body:        "{\"employees\":\"100\"}",
+				path:        "/api/v2/records/43",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":43,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"employees":"100"\}\}\n$`,
+			},
+			{
+				description: "Post retroactive correction for January 2000",
+				method:      "POST",
+				body:        "{\"employees\":\"120\"}",
+				path:        "/api/v2/records/43?valid_from=2000-01-01T00:00:00Z&valid_to=2000-02-01T00:00:00Z",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":43,"version":\d+,"start":"\d+","valid_from":"20000101000000000000000","valid_to":"20000201000000000000000","data":\{"employees":"120"\}\}\n$`,
+			},
+			{
+				description: "Get the version valid now rather than the correction",
+				method:      "GET",
+				path:        "/api/v2/records/43",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":43,"version":\d+,"start":"\d+","end":"\d+","valid_from":"\d+","data":\{"employees":"100"\}\}\n$`,
+			},
+			{
+				description: "Post with valid_to before valid_from",
+				method:      "POST",
+				body:        "{\"employees\":\"130\"}",
+				path:        "/api/v2/records/43?valid_from=2000-02-01T00:00:00Z&valid_to=2000-01-01T00:00:00Z",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid validity; valid_to must be after valid_from"\}\n$`,
+			},
+			{
+				description: "Get what is now known to be true in January 2000",
+				method:      "GET",
+				path:        "/api/v2/records/43?valid_at=2000-01-15T00:00:00Z",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":43,"version":\d+,"start":"\d+","valid_from":"20000101000000000000000","valid_to":"20000201000000000000000","data":\{"employees":"120"\}\}\n$`,
+			},
+			{
+				description: "Get what is now known to be true in the future",
+				method:      "GET",
+				path:        "/api/v2/records/43?valid_at=" + future,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":43,"version":\d+,"start":"\d+","end":"\d+","valid_from":"\d+","data":\{"employees":"100"\}\}\n$`,
+			},
+			{
+				description: "Get what was known in 1999",
+				method:      "GET",
+				path:        "/api/v2/records/43?known_at=1999-01-01T00:00:00Z&valid_at=2000-01-15T00:00:00Z",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"record of id 43 was not known at 1999-01-01T00:00:00Z to be valid at 2000-01-15T00:00:00Z"\}\n$`,
+			},
+			{
+				description: "Get with at combined with valid_at",
+				method:      "GET",
+				path:        "/api/v2/records/43?at=2000-01-15T00:00:00Z&valid_at=2000-01-15T00:00:00Z",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid query; at cannot be combined with known_at or valid_at"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+				req.Header.Set("Content-Type", "application/json")
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_DiffVersions_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		// the unit test database is kept between runs, so the versions are read from the responses
+		versions := make([]int, 0, 2)
+		for _, bodyStr := range []string{
+			"{\"a\":\"1\",\"b\":\"2\",\"c\":\"3\",\"d\":null}",
+			"{\"a\":\"10\",\"b\":null,\"d\":\"4\"}",
+		} {
+			reqPost := httptest.NewRequest("POST", "/api/v2/records/44", bytes.NewBuffer([]byte(bodyStr)))
+			reqPost.Header.Set("Content-Type", "application/json")
+			rrPost := httptest.NewRecorder()
+			router.ServeHTTP(rrPost, reqPost)
+			require.Equal(t, http.StatusOK, rrPost.Code)
+
+			var record struct {
+				Version int `json:"version"`
+			}
+			require.NoError(t, json.Unmarshal(rrPost.Body.Bytes(), &record))
+			versions = append(versions, record.Version)
+		}
+
+		tests := []struct {
+			description string
+			path        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Diff two versions",
+				path:        fmt.Sprintf("/api/v2/records/44/diff?from=%d&to=%d", versions[0], versions[1]),
+				wantStatus:  http.StatusOK,
+				wantBody:    fmt.Sprintf("{\"id\":44,\"from\":%d,\"to\":%d,\"added\":{\"d\":\"4\"},\"removed\":{\"b\":\"2\"},\"changed\":{\"a\":{\"old\":\"1\",\"new\":\"10\"}}}\n", versions[0], versions[1]),
+			},
+			{
+				description: "Diff a version with itself",
+				path:        fmt.Sprintf("/api/v2/records/44/diff?from=%d&to=%d", versions[1], versions[1]),
+				wantStatus:  http.StatusOK,
+				wantBody:    fmt.Sprintf("{\"id\":44,\"from\":%d,\"to\":%d,\"added\":{},\"removed\":{},\"changed\":{}}\n", versions[1], versions[1]),
+			},
+			{
+				description: "Diff with a non-existent version",
+				path:        fmt.Sprintf("/api/v2/records/44/diff?from=%d&to=%d", versions[1], versions[1]+1),
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    fmt.Sprintf("{\"error\":\"record of id 44 does not have versions %d and %d\"}\n", versions[1], versions[1]+1),
+			},
+			{
+				description: "Diff with missing from",
+				path:        "/api/v2/records/44/diff?to=1",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"invalid from; from must be a positive number\"}\n",
+			},
+			{
+				description: "Diff with invalid to",
+				path:        "/api/v2/records/44/diff?from=1&to=-3",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"invalid to; to must be a positive number\"}\n",
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("GET", tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Equal(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_RevertRecord_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		// the unit test database is kept between runs, so the versions are read from the responses
+		versions := make([]int, 0, 2)
+		for _, bodyStr := range []string{
+			"{\"limit\":\"1000\",\"bulk\":null}",
+			"{\"limit\":\"5\",\"bulk\":\"oops\"}",
+		} {
+			reqPost := httptest.NewRequest("POST", "/api/v2/records/45", bytes.NewBuffer([]byte(bodyStr)))
+			reqPost.Header.Set("Content-Type", "application/json")
+			rrPost := httptest.NewRecorder()
+			router.ServeHTTP(rrPost, reqPost)
+			require.Equal(t, http.StatusOK, rrPost.Code)
+
+			var record struct {
+				Version int `json:"version"`
+			}
+			require.NoError(t, json.Unmarshal(rrPost.Body.Bytes(), &record))
+			versions = append(versions, record.Version)
+		}
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Revert to the version before the bad edit",
+				method:      "POST",
+				path:        fmt.Sprintf("/api/v2/records/45/revert/%d", versions[0]),
+				wantStatus:  http.StatusOK,
+				wantBody:    fmt.Sprintf(`^\{"id":45,"version":%d,"start":"\d+","valid_from":"\d+","data":\{"limit":"1000"\}\}\n$`, versions[1]+1),
+			},
+			{
+				description: "Get reverted record",
+				method:      "GET",
+				path:        "/api/v2/records/45",
+				wantStatus:  http.StatusOK,
+				wantBody:    fmt.Sprintf(`^\{"id":45,"version":%d,"start":"\d+","valid_from":"\d+","data":\{"limit":"1000"\}\}\n$`, versions[1]+1),
+			},
+			{
+				description: "Get bad edit which is kept in history",
+				method:      "GET",
+				path:        fmt.Sprintf("/api/v2/records/45/versions/%d", versions[1]),
+				wantStatus:  http.StatusOK,
+				wantBody:    fmt.Sprintf(`^\{"id":45,"version":%d,"start":"\d+","end":"\d+","valid_from":"\d+","data":\{"bulk":"oops","limit":"5"\}\}\n$`, versions[1]),
+			},
+			{
+				description: "Revert to a non-existent version",
+				method:      "POST",
+				path:        fmt.Sprintf("/api/v2/records/45/revert/%d", versions[1]+2),
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    fmt.Sprintf(`^\{"error":"record of id 45 version %d does not exist"\}\n$`, versions[1]+2),
+			},
+			{
+				description: "Revert to an invalid version",
+				method:      "POST",
+				path:        "/api/v2/records/45/revert/abc",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid version; version must be a positive number"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_ConditionalUpdate_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		reqPost := httptest.NewRequest("POST", "/api/v2/records/46", bytes.NewBuffer([]byte("{\"limit\":\"1000\"}")))
+		reqPost.Header.Set("Content-Type", "application/json")
+		rrPost := httptest.NewRecorder()
+		router.ServeHTTP(rrPost, reqPost)
+		require.Equal(t, http.StatusOK, rrPost.Code)
+
+		// the unit test database is kept between runs, so the version is read from the response
+		var record struct {
+			Version int `json:"version"`
+		}
+		require.NoError(t, json.Unmarshal(rrPost.Body.Bytes(), &record))
+		etag := fmt.Sprintf("\"%d\"", record.Version)
+		require.Equal(t, etag, rrPost.Header().Get("ETag"))
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			ifMatch     string
+			wantStatus  int
+			wantETag    string
+			wantBody    string
+		}{
+			{
+				description: "Get returns the ETag of the latest version",
+				method:      "GET",
+				wantStatus:  http.StatusOK,
+				wantETag:    etag,
+				wantBody:    `^\{"id":46,.*"data":\{"limit":"1000"\}\}\n$`,
+			},
+			{
+				description: "Update with matching If-Match",
+				method:      "POST",
+				ifMatch:     etag,
+				wantStatus:  http.StatusOK,
+				wantETag:    fmt.Sprintf("\"%d\"", record.Version+1),
+				wantBody:    `^\{"id":46,.*"data":\{"limit":"2000"\}\}\n$`,
+			},
+			{
+				description: "Update with stale If-Match",
+				method:      "POST",
+				ifMatch:     etag,
+				wantStatus:  http.StatusPreconditionFailed,
+				wantBody:    fmt.Sprintf(`^\{"error":"precondition failed; record of id 46 is no longer at version %d"\}\n$`, record.Version),
+			},
+			{
+				description: "Update with invalid If-Match",
+				method:      "POST",
+				ifMatch:     "version-1",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid If-Match; expected \* or a list of entity tags"\}\n$`,
+			},
+			{
+				description: "Update with wildcard If-Match",
+				method:      "POST",
+				ifMatch:     "*",
+				wantStatus:  http.StatusOK,
+				wantETag:    fmt.Sprintf("\"%d\"", record.Version+2),
+				wantBody:    `^\{"id":46,.*"data":\{"limit":"2000"\}\}\n$`,
+			},
+			{
+				description: "Update with a list of entity tags, one matching",
+				method:      "POST",
+				ifMatch:     fmt.Sprintf(`%s, "%d"`, etag, record.Version+2),
+				wantStatus:  http.StatusOK,
+				wantETag:    fmt.Sprintf("\"%d\"", record.Version+3),
+				wantBody:    `^\{"id":46,.*"data":\{"limit":"2000"\}\}\n$`,
+			},
+			{
+				description: "Update with a list of stale entity tags",
+				method:      "POST",
+				ifMatch:     fmt.Sprintf(`%s,"%d"`, etag, record.Version+1),
+				wantStatus:  http.StatusPreconditionFailed,
+				wantBody:    fmt.Sprintf(`^\{"error":"precondition failed; record of id 46 is at none of the versions %d, %d"\}\n$`, record.Version, record.Version+1),
+			},
+			{
+				description: "Update with a weak If-Match",
+				method:      "POST",
+				ifMatch:     fmt.Sprintf(`W/"%d"`, record.Version+3),
+				wantStatus:  http.StatusPreconditionFailed,
+				wantBody:    `^\{"error":"precondition failed; If-Match names no version of record of id 46"\}\n$`,
+			},
+			{
+				description: "Update with an entity tag that is no version",
+				method:      "POST",
+				ifMatch:     `"limit,1000"`,
+				wantStatus:  http.StatusPreconditionFailed,
+				wantBody:    `^\{"error":"precondition failed; If-Match names no version of record of id 46"\}\n$`,
+			},
+			{
+				description: "Update of a missing record with wildcard If-Match",
+				method:      "POST",
+				path:        "/api/v2/records/2147483647",
+				ifMatch:     "*",
+				wantStatus:  http.StatusPreconditionFailed,
+				wantBody:    `^\{"error":"precondition failed; record of id 2147483647 does not exist"\}\n$`,
+			},
+			{
+				description: "Missing record is not created by a failed precondition",
+				method:      "GET",
+				path:        "/api/v2/records/2147483647",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"record of id 2147483647 does not exist"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				path := tc.path
+				if path == "" {
+					path = "/api/v2/records/46"
+				}
+				req := httptest.NewRequest(tc.method, path, bytes.NewBuffer([]byte("{\"limit\":\"2000\"}")))
+				req.Header.Set("Content-Type", "application/json")
+				if tc.ifMatch != "" {
+					req.Header.Set("If-Match", tc.ifMatch)
+				}
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Equal(t, tc.wantETag, rr.Header().Get("ETag"))
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_Snapshot_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		var between string
+		for i, bodyStr := range []string{"{\"snap\":\"1\"}", "{\"snap\":\"2\"}"} {
+			if i > 0 {
+				time.Sleep(time.Millisecond)
+				between = time.Now().UTC().Format(time.RFC3339Nano)
+				time.Sleep(time.Millisecond)
+			}
+			reqPost := httptest.NewRequest("POST", "/api/v2/records/48", bytes.NewBuffer([]byte(bodyStr)))
+			reqPost.Header.Set("Content-Type", "application/json")
+			rrPost := httptest.NewRecorder()
+			router.ServeHTTP(rrPost, reqPost)
+			require.Equal(t, http.StatusOK, rrPost.Code)
+		}
+
+		tests := []struct {
+			description string
+			path        string
+			wantStatus  int
+			wantLines   bool
+			wantData    map[string]string // data of record 48 in the snapshot; nil if it must be absent
+			wantBody    string
+		}{
+			{
+				description: "Snapshot between the two updates",
+				path:        "/api/v2/snapshot?at=" + between,
+				wantStatus:  http.StatusOK,
+				wantLines:   true,
+				wantData:    map[string]string{"snap": "1"},
+			},
+			{
+				description: "Snapshot in the future",
+				path:        "/api/v2/snapshot?at=" + time.Now().UTC().Add(time.Hour).Format(time.RFC3339),
+				wantStatus:  http.StatusOK,
+				wantLines:   true,
+				wantData:    map[string]string{"snap": "2"},
+			},
+			{
+				description: "Snapshot before any record existed",
+				path:        "/api/v2/snapshot?at=1999-01-01T00:00:00Z",
+				wantStatus:  http.StatusOK,
+				wantBody:    "",
+			},
+			{
+				description: "Snapshot without at",
+				path:        "/api/v2/snapshot",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"invalid at; at must be an RFC3339 timestamp\"}\n",
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("GET", tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				if !tc.wantLines {
+					require.Equal(t, tc.wantBody, rr.Body.String())
+					return
+				}
+
+				// one record per line in ascending id order
+				var data map[string]string
+				lastID := 0
+				decoder := json.NewDecoder(rr.Body)
+				for decoder.More() {
+					var record entity.PersistentRecord
+					require.NoError(t, decoder.Decode(&record))
+					require.Greater(t, record.ID, lastID)
+					lastID = record.ID
+					if record.ID == 48 {
+						data = record.Data
+					}
+				}
+				require.Equal(t, tc.wantData, data)
+				require.Equal(t, "complete", rr.Result().Trailer.Get("X-Stream-Status"))
+			})
+		}
+	})
+}
+
+func Test_Snapshot_V2_StoreFailure(t *testing.T) {
+	// the database is closed under the router, so this test uses its own
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	router := NewAPI(nil, nil, db).SetupRouter(db)
+	require.NoError(t, db.Close())
+
+	// the status has been sent before the records are read, so the trailer reports the failure
+	req := httptest.NewRequest("GET", "/api/v2/snapshot?at=2026-01-01T00:00:00Z", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "X-Stream-Status", rr.Header().Get("Trailer"))
+	require.Equal(t, "error", rr.Result().Trailer.Get("X-Stream-Status"))
+}
+
+func Test_Export_V2(t *testing.T) {
+	forEachStore(t, "unit-test.db", func(t *testing.T, router *mux.Router) {
+
+		for _, bodyStr := range []string{"{\"export\":\"1\"}", "{\"export\":\"2\"}"} {
+			reqPost := httptest.NewRequest("POST", "/api/v2/records/49", bytes.NewBuffer([]byte(bodyStr)))
+			reqPost.Header.Set("Content-Type", "application/json")
+			rrPost := httptest.NewRecorder()
+			router.ServeHTTP(rrPost, reqPost)
+			require.Equal(t, http.StatusOK, rrPost.Code)
+		}
+
+		tests := []struct {
+			description string
+			path        string
+			wantStatus  int
+			wantLines   bool
+			check       func(t *testing.T, records []entity.PersistentRecord)
+			wantBody    string
+		}{
+			{
+				description: "Export all versions of one record",
+				path:        "/api/v2/export?from_id=49&to_id=49",
+				wantStatus:  http.StatusOK,
+				wantLines:   true,
+				check: func(t *testing.T, records []entity.PersistentRecord) {
+					require.GreaterOrEqual(t, len(records), 2)
+					for i, record := range records {
+						require.Equal(t, 49, record.ID)
+						require.Equal(t, i+1, record.Version)
+						require.NotEmpty(t, record.Start)
+					}
+					require.NotEmpty(t, records[len(records)-2].End)
+					require.Equal(t, map[string]string{"export": "2"}, records[len(records)-1].Data)
+				},
+			},
+			{
+				description: "Export only versions current from now on",
+				path:        "/api/v2/export?since=" + time.Now().UTC().Add(time.Hour).Format(time.RFC3339),
+				wantStatus:  http.StatusOK,
+				wantLines:   true,
+				check: func(t *testing.T, records []entity.PersistentRecord) {
+					require.NotEmpty(t, records)
+					for i, record := range records {
+						require.Empty(t, record.End)
+						if i > 0 {
+							require.Greater(t, record.ID, records[i-1].ID)
+						}
+					}
+				},
+			},
+			{
+				description: "Export with invalid from_id",
+				path:        "/api/v2/export?from_id=abc",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"invalid from_id; from_id must be a positive number\"}\n",
+			},
+			{
+				description: "Export with invalid until",
+				path:        "/api/v2/export?until=tomorrow",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    "{\"error\":\"invalid until; until must be an RFC3339 timestamp\"}\n",
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("GET", tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				if !tc.wantLines {
+					require.Equal(t, tc.wantBody, rr.Body.String())
+					return
+				}
+
+				var records []entity.PersistentRecord
+				decoder := json.NewDecoder(rr.Body)
+				for decoder.More() {
+					var record entity.PersistentRecord
+					require.NoError(t, decoder.Decode(&record))
+					records = append(records, record)
+				}
+				tc.check(t, records)
+				require.Equal(t, "complete", rr.Result().Trailer.Get("X-Stream-Status"))
+			})
+		}
+	})
+}
+
+func Test_ImportRecords_V2(t *testing.T) {
+	// imports need ids without history, so this test uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		lines := `{"id":1,"version":1,"start":"20200101000000000000000","end":"20200201000000000000000","data":{"a":"1"}}
+{"id":1,"version":2,"start":"20200201000000000000000","data":{"a":"2"}}
+{"id":2,"version":2,"start":"20200101000000000000000","data":{}}
+{"id":3,
+{"id":3,"version":1,"start":"20200101000000000000000","end":"20191231000000000000000","data":{}}
+{"id":1,"version":3,"start":"20200301000000000000000","data":{}}
+{"id":4,"version":1,"start":"yesterday","data":{}}
+{"id":1,"version":4,"start":"20200301000000000000000","data":{}}
+`
+		wantErrors := `"errors":\[` +
+			`\{"line":3,"error":"version 2 of record 2 does not follow version 0"\},` +
+			`\{"line":4,"error":"could not parse json: [^"]*"\},` +
+			`\{"line":5,"error":"end 20191231000000000000000 is not after start 20200101000000000000000"\},` +
+			`\{"line":6,"error":"version 3 of record 1 starts before the import, so closing the still open previous version then would rewrite recorded history"\},` +
+			`\{"line":7,"error":"invalid start: invalid timestamp \\"yesterday\\""\},` +
+			`\{"line":8,"error":"version 4 of record 1 does not follow version 2"\}\]`
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			body        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Dry run reports every bad line",
+				method:      "POST",
+				path:        "/api/v2/import?dry_run=true",
+				body:        lines,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"dry_run":true,"imported":2,"failed":6,` + wantErrors + `\}\n$`,
+			},
+			{
+				description: "Dry run does not write",
+				method:      "GET",
+				path:        "/api/v2/records/1",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"record of id 1 does not exist"\}\n$`,
+			},
+			{
+				description: "Import writes the good lines",
+				method:      "POST",
+				path:        "/api/v2/import",
+				body:        lines,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"dry_run":false,"imported":2,"failed":6,` + wantErrors + `\}\n$`,
+			},
+			{
+				description: "Imported history is readable",
+				method:      "GET",
+				path:        "/api/v2/records/1/versions/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":1,"start":"20200101000000000000000","end":"20200201000000000000000","valid_from":"20200101000000000000000","data":\{"a":"1"\}\}\n$`,
+			},
+			{
+				description: "Imported open version stays open",
+				method:      "GET",
+				path:        "/api/v2/records/1/versions/2",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":2,"start":"20200201000000000000000","valid_from":"20200201000000000000000","data":\{"a":"2"\}\}\n$`,
+			},
+			{
+				description: "Import does not close a stored open version in the past",
+				method:      "POST",
+				path:        "/api/v2/import",
+				body:        `{"id":1,"version":3,"start":"20200401000000000000000","data":{"a":"3"}}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"dry_run":false,"imported":0,"failed":1,"errors":\[\{"line":1,"error":"version 3 of record 1 starts before the import, so closing the still open previous version then would rewrite recorded history"\}\]\}\n$`,
+			},
+			{
+				description: "Imported history is continued by updates",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"b":"3"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":3,"start":"\d+","valid_from":"\d+","data":\{"a":"2","b":"3"\}\}\n$`,
+			},
+			{
+				description: "Updated history is extended by imports",
+				method:      "POST",
+				path:        "/api/v2/import",
+				body:        `{"id":1,"version":4,"start":"29990101000000000000000","data":{"a":"4"}}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"dry_run":false,"imported":1,"failed":0,"errors":\[\]\}\n$`,
+			},
+			{
+				description: "Extended version is closed at the start of the import",
+				method:      "GET",
+				path:        "/api/v2/records/1/versions/3",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":3,"start":"\d+","end":"29990101000000000000000",`,
+			},
+			{
+				description: "Closed versions keep the hash chain intact",
+				method:      "GET",
+				path:        "/api/v2/records/1/verify",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"versions":4,"valid":true,"hash":"[0-9a-f]{64}"\}\n$`,
+			},
+			{
+				description: "Import with invalid dry_run",
+				method:      "POST",
+				path:        "/api/v2/import?dry_run=maybe",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid dry_run; dry_run must be true or false"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_UpdateRecords_V2(t *testing.T) {
+	// the expected versions depend on a fresh history, so this test uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		record := func(id int, version int, data string) string {
+			return fmt.Sprintf(`\{"id":%d,"version":%d,"start":"\d+","valid_from":"\d+","data":\{%s\}\}`, id, version, data)
+		}
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			body        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Atomic batch creates records",
+				method:      "POST",
+				path:        "/api/v2/records:batch",
+				body:        `[{"id":1,"data":{"a":"1","b":"2"}},{"id":2,"data":{"a":"1"}}]`,
+				wantStatus:  http.StatusOK,
+				wantBody: `^\{"atomic":true,"updated":2,"failed":0,"results":\[` +
+					`\{"index":0,"id":1,"record":` + record(1, 1, `"a":"1","b":"2"`) + `\},` +
+					`\{"index":1,"id":2,"record":` + record(2, 1, `"a":"1"`) + `\}\]\}\n$`,
+			},
+			{
+				description: "Atomic batch with a conflict applies nothing",
+				method:      "POST",
+				path:        "/api/v2/records:batch",
+				body:        `[{"id":1,"data":{"b":null}},{"id":2,"data":{"a":"2"},"expected_version":5}]`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody: `^\{"atomic":true,"updated":0,"failed":2,"results":\[` +
+					`\{"index":0,"id":1,"error":"not applied; another update of the batch failed"\},` +
+					`\{"index":1,"id":2,"error":"record of id 2 is no longer at version 5"\}\]\}\n$`,
+			},
+			{
+				description: "Rolled back update is not stored",
+				method:      "GET",
+				path:        "/api/v2/records/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^` + record(1, 1, `"a":"1","b":"2"`) + `\n$`,
+			},
+			{
+				description: "Best-effort batch skips failing updates",
+				method:      "POST",
+				path:        "/api/v2/records:batch?atomic=false",
+				body:        `[{"id":1,"data":{"b":null},"expected_version":1},{"id":0,"data":{}},{"id":2,"data":{"a":"2"},"expected_version":5},{"id":1,"data":{"c":"3"}}]`,
+				wantStatus:  http.StatusOK,
+				wantBody: `^\{"atomic":false,"updated":2,"failed":2,"results":\[` +
+					`\{"index":0,"id":1,"record":` + record(1, 2, `"a":"1"`) + `\},` +
+					`\{"index":1,"id":0,"error":"record id must \\u003e= 0"\},` +
+					`\{"index":2,"id":2,"error":"record of id 2 is no longer at version 5"\},` +
+					`\{"index":3,"id":1,"record":` + record(1, 3, `"a":"1","c":"3"`) + `\}\]\}\n$`,
+			},
+			{
+				description: "Batch with invalid atomic",
+				method:      "POST",
+				path:        "/api/v2/records:batch?atomic=maybe",
+				body:        `[]`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid atomic; atomic must be true or false"\}\n$`,
+			},
+			{
+				description: "Batch with invalid body",
+				method:      "POST",
+				path:        "/api/v2/records:batch",
+				body:        `{"id":1}`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; could not parse json"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_TypedRecords_V3(t *testing.T) {
+	// the expected versions depend on a fresh history, so this test uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		record := func(version int, data string) string {
+			return fmt.Sprintf(`^\{"id":1,"version":%d,"start":"\d+",("end":"\d+",)?"valid_from":"\d+","data":\{%s\}\}\n$`, version, data)
+		}
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			body        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Create record with typed values",
+				method:      "POST",
+				path:        "/api/v3/records/1",
+				body:        `{"employees":120,"insured":true,"limits":[1000,2000],"address":{"city":"Oslo"},"name":"Acme"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(1, `"address":\{"city":"Oslo"\},"employees":120,"insured":true,"limits":\[1000,2000\],"name":"Acme"`),
+			},
+			{
+				description: "V2 serves typed values as their JSON text",
+				method:      "GET",
+				path:        "/api/v2/records/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    record(1, `"address":"\{\\"city\\":\\"Oslo\\"\}","employees":"120","insured":"true","limits":"\[1000,2000\]","name":"Acme"`),
+			},
+			{
+				description: "V2 still rejects non-string values",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"employees":121}`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; could not parse json"\}\n$`,
+			},
+			{
+				description: "V2 update keeps the typed values of other keys",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"name":"Acme Inc","insured":null}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(2, `"address":"\{\\"city\\":\\"Oslo\\"\}","employees":"120","limits":"\[1000,2000\]","name":"Acme Inc"`),
+			},
+			{
+				description: "V3 update replaces and deletes values",
+				method:      "POST",
+				path:        "/api/v3/records/1",
+				body:        `{"employees":121.5,"limits":null}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(3, `"address":\{"city":"Oslo"\},"employees":121.5,"name":"Acme Inc"`),
+			},
+			{
+				description: "V2 revert keeps typed values",
+				method:      "POST",
+				path:        "/api/v2/records/1/revert/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    record(4, `"address":"\{\\"city\\":\\"Oslo\\"\}","employees":"120","insured":"true","limits":"\[1000,2000\]","name":"Acme"`),
+			},
+			{
+				description: "V3 version",
+				method:      "GET",
+				path:        "/api/v3/records/1/versions/4",
+				wantStatus:  http.StatusOK,
+				wantBody:    record(4, `"address":\{"city":"Oslo"\},"employees":120,"insured":true,"limits":\[1000,2000\],"name":"Acme"`),
+			},
+			{
+				description: "V3 list",
+				method:      "GET",
+				path:        "/api/v3/records/1/list",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"records":\[(\{"id":1,"version":\d,[^\n]*\},?){4}\]\}\n$`,
+			},
+			{
+				description: "V3 body must be an object",
+				method:      "POST",
+				path:        "/api/v3/records/1",
+				body:        `[1,2]`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; could not parse json"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_Schemas_V2(t *testing.T) {
+	// schema versions depend on a fresh database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		schemaV1 := `{"type":"object","required":["employer"],"properties":{"employees":{"type":"string","pattern":"^[0-9]+$"}}}`
+		schemaV2 := `{"type":"object","required":["employer","state"],"properties":{"employees":{"type":"string","pattern":"^[0-9]+$"}}}`
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			body        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Register first schema version",
+				method:      "PUT",
+				path:        "/api/v2/schemas/workers_comp_application",
+				body:        schemaV1,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"record_type":"workers_comp_application","version":1,"created":"\d+","schema":\{"type":"object",.*\}\}\n$`,
+			},
+			{
+				description: "Create typed record",
+				method:      "POST",
+				path:        "/api/v2/records/1?type=workers_comp_application",
+				body:        `{"employer":"Acme","employees":"12"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":1,"start":"\d+","valid_from":"\d+","record_type":"workers_comp_application","schema_version":1,"data":\{"employees":"12","employer":"Acme"\}\}\n$`,
+			},
+			{
+				description: "Update not matching the schema",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"employer":null,"employees":"twelve"}`,
+				wantStatus:  http.StatusUnprocessableEntity,
+				wantBody: `^\{"error":"invalid input; record does not match schema workers_comp_application version 1","fields":\[` +
+					`\{"field":"/employer","error":"is required"\},` +
+					`\{"field":"/employees","error":"must match pattern \^\[0-9\]\+\$"\}\]\}\n$`,
+			},
+			{
+				description: "Register second schema version",
+				method:      "PUT",
+				path:        "/api/v2/schemas/workers_comp_application",
+				body:        schemaV2,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"record_type":"workers_comp_application","version":2,`,
+			},
+			{
+				description: "Updates must match the schema in force",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"employees":"13"}`,
+				wantStatus:  http.StatusUnprocessableEntity,
+				wantBody:    `^\{"error":"invalid input; record does not match schema workers_comp_application version 2","fields":\[\{"field":"/state","error":"is required"\}\]\}\n$`,
+			},
+			{
+				description: "Update matching the new schema",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"employees":"13","state":"CA"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":2,"start":"\d+","valid_from":"\d+","record_type":"workers_comp_application","schema_version":2,`,
+			},
+			{
+				description: "Historical version keeps its schema version",
+				method:      "GET",
+				path:        "/api/v2/records/1/versions/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    `"record_type":"workers_comp_application","schema_version":1,`,
+			},
+			{
+				description: "Get the latest schema",
+				method:      "GET",
+				path:        "/api/v2/schemas/workers_comp_application",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"record_type":"workers_comp_application","version":2,"created":"\d+","schema":\{"type":"object","required":\["employer","state"\]`,
+			},
+			{
+				description: "Get a schema version",
+				method:      "GET",
+				path:        "/api/v2/schemas/workers_comp_application/versions/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"record_type":"workers_comp_application","version":1,"created":"\d+","schema":\{"type":"object","required":\["employer"\]`,
+			},
+			{
+				description: "Get a schema that does not exist",
+				method:      "GET",
+				path:        "/api/v2/schemas/auto_application",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"schema of type auto_application does not exist"\}\n$`,
+			},
+			{
+				description: "Register an invalid schema",
+				method:      "PUT",
+				path:        "/api/v2/schemas/auto_application",
+				body:        `{"type":"decimal"}`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; schema is not a valid JSON Schema: /type: unknown type decimal"\}\n$`,
+			},
+			{
+				description: "Register a schema with an invalid type",
+				method:      "PUT",
+				path:        "/api/v2/schemas/Auto",
+				body:        `{}`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid type; type must be lowercase letters, digits and underscores"\}\n$`,
+			},
+			{
+				description: "Create record of a type without schema",
+				method:      "POST",
+				path:        "/api/v2/records/2?type=auto_application",
+				body:        `{}`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid type; no schema is registered for the record type"\}\n$`,
+			},
+			{
+				description: "Records without type are not validated",
+				method:      "POST",
+				path:        "/api/v2/records/3",
+				body:        `{"employees":"twelve"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":3,"version":1,"start":"\d+","valid_from":"\d+","data":\{"employees":"twelve"\}\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_DeleteRecord_V2(t *testing.T) {
+	// the snapshot must only contain the records of this test, so it uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			body        string
+			ifMatch     string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Create records",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"a":"1","b":"2"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":1,`,
+			},
+			{
+				description: "Create another record",
+				method:      "POST",
+				path:        "/api/v2/records/2",
+				body:        `{"a":"1"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":2,"version":1,`,
+			},
+			{
+				description: "Conditional delete of a stale version",
+				method:      "DELETE",
+				path:        "/api/v2/records/1",
+				ifMatch:     `"7"`,
+				wantStatus:  http.StatusPreconditionFailed,
+				wantBody:    `^\{"error":"precondition failed; record of id 1 is no longer at version 7"\}\n$`,
+			},
+			{
+				description: "Delete writes a tombstone",
+				method:      "DELETE",
+				path:        "/api/v2/records/1",
+				ifMatch:     `"1"`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":2,"start":"\d+","valid_from":"\d+","deleted":true,"data":\{\}\}\n$`,
+			},
+			{
+				description: "Deleted record is gone",
+				method:      "GET",
+				path:        "/api/v2/records/1",
+				wantStatus:  http.StatusGone,
+				wantBody:    `^\{"error":"record of id 1 has been deleted"\}\n$`,
+			},
+			{
+				description: "Deleted record is gone in v3",
+				method:      "GET",
+				path:        "/api/v3/records/1",
+				wantStatus:  http.StatusGone,
+				wantBody:    `^\{"error":"record of id 1 has been deleted"\}\n$`,
+			},
+			{
+				description: "Delete a deleted record",
+				method:      "DELETE",
+				path:        "/api/v2/records/1",
+				wantStatus:  http.StatusGone,
+				wantBody:    `^\{"error":"record of id 1 has been deleted"\}\n$`,
+			},
+			{
+				description: "Delete a record that does not exist",
+				method:      "DELETE",
+				path:        "/api/v2/records/3",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"record of id 3 does not exist"\}\n$`,
+			},
+			{
+				description: "History stays available",
+				method:      "GET",
+				path:        "/api/v2/records/1/versions/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":1,"start":"\d+","end":"\d+","valid_from":"\d+","data":\{"a":"1","b":"2"\}\}\n$`,
+			},
+			{
+				description: "List shows the tombstone",
+				method:      "GET",
+				path:        "/api/v2/records/1/list",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"records":\[\{"id":1,"version":1,[^\]]*\},\{"id":1,"version":2,"start":"\d+","valid_from":"\d+","deleted":true,"data":\{\}\}\]\}\n$`,
+			},
+			{
+				description: "Snapshot leaves out deleted records",
+				method:      "GET",
+				path:        "/api/v2/snapshot?at=2100-01-01T00:00:00Z",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":2,"version":1,[^\n]*\}\n$`,
+			},
+			{
+				description: "Undelete by posting a new version",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"c":"3"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":3,"start":"\d+","valid_from":"\d+","data":\{"c":"3"\}\}\n$`,
+			},
+			{
+				description: "Undeleted record is back",
+				method:      "GET",
+				path:        "/api/v2/records/1",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":3,`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+				if tc.ifMatch != "" {
+					req.Header.Set("If-Match", tc.ifMatch)
+				}
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_PatchRecord_V2(t *testing.T) {
+	// the expected versions depend on a fresh history, so this test uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		record := func(version int, data string) string {
+			return fmt.Sprintf(`^\{"id":1,"version":%d,"start":"\d+","valid_from":"\d+","data":\{%s\}\}\n$`, version, data)
+		}
+
+		tests := []struct {
+			description string
+			contentType string
+			body        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Merge patch creates the record",
+				contentType: "application/merge-patch+json",
+				body:        `{"a":"1","b":"2","c/d":"3"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(1, `"a":"1","b":"2","c/d":"3"`),
+			},
+			{
+				description: "Merge patch deletes keys with null",
+				contentType: "application/merge-patch+json",
+				body:        `{"b":null,"e":"5"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(2, `"a":"1","c/d":"3","e":"5"`),
+			},
+			{
+				description: "Merge patch sets values of any type",
+				contentType: "application/merge-patch+json",
+				body:        `{"limits":{"a":1,"b":{"c":true}},"n":2}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(3, `"a":"1","c/d":"3","e":"5","limits":"\{\\"a\\":1,\\"b\\":\{\\"c\\":true\}\}","n":"2"`),
+			},
+			{
+				description: "Merge patch merges objects recursively",
+				contentType: "application/merge-patch+json",
+				body:        `{"limits":{"b":{"c":null},"d":"x"}}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(4, `"a":"1","c/d":"3","e":"5","limits":"\{\\"a\\":1,\\"b\\":\{\},\\"d\\":\\"x\\"\}","n":"2"`),
+			},
+			{
+				description: "Merge patch deletes values of any type with null",
+				contentType: "application/merge-patch+json",
+				body:        `{"limits":null,"n":null}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(5, `"a":"1","c/d":"3","e":"5"`),
+			},
+			{
+				description: "Merge patch must be an object",
+				contentType: "application/merge-patch+json",
+				body:        `["a"]`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; could not parse json merge patch"\}\n$`,
+			},
+			{
+				description: "Plain updates must be an object of strings",
+				contentType: "application/json",
+				body:        `{"a":1}`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; could not parse json"\}\n$`,
+			},
+			{
+				description: "Update with an unsupported media type",
+				contentType: "text/plain",
+				body:        `{"a":"2"}`,
+				wantStatus:  http.StatusUnsupportedMediaType,
+				wantBody:    `^\{"error":"unsupported media type; expected application/json, application/merge-patch\+json or application/json-patch\+json"\}\n$`,
+			},
+			{
+				description: "JSON patch with every operation",
+				contentType: "application/json-patch+json; charset=utf-8",
+				body: `[{"op":"test","path":"/a","value":"1"},{"op":"replace","path":"/a","value":"10"},` +
+					`{"op":"move","from":"/c~1d","path":"/c"},{"op":"copy","from":"/e","path":"/f"},` +
+					`{"op":"remove","path":"/e"},{"op":"add","path":"/g~0","value":"7"}]`,
+				wantStatus: http.StatusOK,
+				wantBody:   record(6, `"a":"10","c":"3","f":"5","g~":"7"`),
+			},
+			{
+				description: "JSON patch with a failing test applies nothing",
+				contentType: "application/json-patch+json",
+				body:        `[{"op":"remove","path":"/c"},{"op":"test","path":"/a","value":"1"}]`,
+				wantStatus:  http.StatusConflict,
+				wantBody:    `^\{"error":"json patch could not be applied: operation 1: test failed; /a is \\"10\\", not \\"1\\""\}\n$`,
+			},
+			{
+				description: "JSON patch removing a missing key",
+				contentType: "application/json-patch+json",
+				body:        `[{"op":"remove","path":"/x"}]`,
+				wantStatus:  http.StatusConflict,
+				wantBody:    `^\{"error":"json patch could not be applied: operation 0: path /x does not exist"\}\n$`,
+			},
+			{
+				description: "JSON patch with an unknown op",
+				contentType: "application/json-patch+json",
+				body:        `[{"op":"increment","path":"/a"}]`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; invalid json patch: operation 0: unknown op \\"increment\\""\}\n$`,
+			},
+			{
+				description: "JSON patch with a nested path",
+				contentType: "application/json-patch+json",
+				body:        `[{"op":"add","path":"/a/b","value":"1"}]`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; invalid json patch: operation 0: path \\"/a/b\\" must address a key of the record"\}\n$`,
+			},
+			{
+				description: "JSON patch with a non-string value",
+				contentType: "application/json-patch+json",
+				body:        `[{"op":"add","path":"/a","value":1}]`,
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid input; could not parse json patch"\}\n$`,
+			},
+			{
+				description: "Failed patches wrote no version",
+				contentType: "application/json-patch+json",
+				body:        `[]`,
+				wantStatus:  http.StatusOK,
+				wantBody:    record(7, `"a":"10","c":"3","f":"5","g~":"7"`),
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("POST", "/api/v2/records/1", bytes.NewBuffer([]byte(tc.body)))
+				req.Header.Set("Content-Type", tc.contentType)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_ChangeMetadata_V2(t *testing.T) {
+	// the expected versions depend on a fresh history, so this test uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		underwriter := map[string]string{
+			"X-Change-Author": "jane@example.com",
+			"X-Change-Reason": "Limit raised after renewal call",
+			"X-Change-Source": "underwriting-ui",
+		}
+
+		tests := []struct {
+			description string
+			method      string
+			path        string
+			body        string
+			headers     map[string]string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Update without metadata",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"limit":"1000"}`,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":1,"start":"\d+","valid_from":"\d+","data":\{"limit":"1000"\}\}\n$`,
+			},
+			{
+				description: "Update with metadata headers",
+				method:      "POST",
+				path:        "/api/v2/records/1",
+				body:        `{"limit":"2000"}`,
+				headers:     underwriter,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":2,"start":"\d+","valid_from":"\d+","author":"jane@example.com","reason":"Limit raised after renewal call","source":"underwriting-ui","data":\{"limit":"2000"\}\}\n$`,
+			},
+			{
+				description: "Batch items carry their own metadata or the headers",
+				method:      "POST",
+				path:        "/api/v2/records:batch",
+				body:        `[{"id":1,"data":{"limit":"2500"},"author":"sync","reason":"Nightly sync"},{"id":2,"data":{"limit":"500"}}]`,
+				headers:     map[string]string{"X-Change-Source": "policy-admin"},
+				wantStatus:  http.StatusOK,
+				wantBody: `^\{"atomic":true,"updated":2,"failed":0,"results":\[` +
+					`\{"index":0,"id":1,"record":\{"id":1,"version":3,"start":"\d+","valid_from":"\d+","author":"sync","reason":"Nightly sync","source":"policy-admin","data":\{"limit":"2500"\}\}\},` +
+					`\{"index":1,"id":2,"record":\{"id":2,"version":1,"start":"\d+","valid_from":"\d+","source":"policy-admin","data":\{"limit":"500"\}\}\}\]\}\n$`,
+			},
+			{
+				description: "Revert with metadata headers",
+				method:      "POST",
+				path:        "/api/v2/records/1/revert/2",
+				headers:     map[string]string{"X-Change-Author": "joe@example.com", "X-Change-Reason": "Sync overwrote the renewal"},
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":4,"start":"\d+","valid_from":"\d+","author":"joe@example.com","reason":"Sync overwrote the renewal","data":\{"limit":"2000"\}\}\n$`,
+			},
+			{
+				description: "Delete with metadata headers",
+				method:      "DELETE",
+				path:        "/api/v2/records/2",
+				headers:     map[string]string{"X-Change-Author": "joe@example.com", "X-Change-Reason": "Duplicate"},
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":2,"version":2,"start":"\d+","valid_from":"\d+","deleted":true,"author":"joe@example.com","reason":"Duplicate","data":\{\}\}\n$`,
+			},
+			{
+				description: "History answers who changed the limit and why",
+				method:      "GET",
+				path:        "/api/v2/records/1/versions/2",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":2,"start":"\d+","end":"\d+","valid_from":"\d+","author":"jane@example.com","reason":"Limit raised after renewal call","source":"underwriting-ui","data":\{"limit":"2000"\}\}\n$`,
+			},
+			{
+				description: "V3 update with metadata headers",
+				method:      "POST",
+				path:        "/api/v3/records/1",
+				body:        `{"limit":3000}`,
+				headers:     underwriter,
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"version":5,"start":"\d+","valid_from":"\d+","author":"jane@example.com","reason":"Limit raised after renewal call","source":"underwriting-ui","data":\{"limit":3000\}\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+				for name, value := range tc.headers {
+					req.Header.Set(name, value)
+				}
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_KeyHistory_V2(t *testing.T) {
+	// the expected versions depend on a fresh history, so this test uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		// employee_count of record 1 is 10 for versions 1-2, 12 for 3-4, gone in 5 and 12 again from 6;
+		// record 3 was corrected for January 2000 after it was written
+		for _, update := range []struct {
+			method string
+			path   string
+			body   string
+		}{
+			{"POST", "/api/v2/records/1", `{"employee_count":"10","state":"CA"}`},
+			{"POST", "/api/v2/records/1", `{"state":"NV"}`},
+			{"POST", "/api/v2/records/1", `{"employee_count":"12"}`},
+			{"POST", "/api/v2/records/1", `{"state":"AZ"}`},
+			{"DELETE", "/api/v2/records/1", ``},
+			{"POST", "/api/v2/records/1", `{"employee_count":"12"}`},
+			{"POST", "/api/v2/records/3", `{"employee_count":"10"}`},
+			{"POST", "/api/v2/records/3?valid_from=2000-01-01T00:00:00Z&valid_to=2000-02-01T00:00:00Z", `{"employee_count":"8"}`},
+		} {
+			req := httptest.NewRequest(update.method, update.path, bytes.NewBuffer([]byte(update.body)))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+		}
+
+		tests := []struct {
+			description string
+			path        string
+			wantStatus  int
+			wantBody    string
+		}{
+			{
+				description: "Collapsed values of a key",
+				path:        "/api/v2/records/1/keys/employee_count/history",
+				wantStatus:  http.StatusOK,
+				wantBody: `^\{"id":1,"key":"employee_count","intervals":\[` +
+					`\{"value":"10","valid_from":"\d+","valid_to":"\d+","versions":\[1,2\]\},` +
+					`\{"value":"12","valid_from":"\d+","valid_to":"\d+","versions":\[3,4\]\},` +
+					`\{"value":"12","valid_from":"\d+","versions":\[6\]\}\]\}\n$`,
+			},
+			{
+				description: "Key removed by an update",
+				path:        "/api/v2/records/1/keys/state/history",
+				wantStatus:  http.StatusOK,
+				wantBody: `^\{"id":1,"key":"state","intervals":\[` +
+					`\{"value":"CA","valid_from":"\d+","valid_to":"\d+","versions":\[1\]\},` +
+					`\{"value":"NV","valid_from":"\d+","valid_to":"\d+","versions":\[2,3\]\},` +
+					`\{"value":"AZ","valid_from":"\d+","valid_to":"\d+","versions":\[4\]\}\]\}\n$`,
+			},
+			{
+				description: "Retroactive correction at the time it is valid",
+				path:        "/api/v2/records/3/keys/employee_count/history",
+				wantStatus:  http.StatusOK,
+				wantBody: `^\{"id":3,"key":"employee_count","intervals":\[` +
+					`\{"value":"8","valid_from":"20000101000000000000000","valid_to":"20000201000000000000000","versions":\[2\]\},` +
+					`\{"value":"10","valid_from":"\d+","versions":\[1\]\}\]\}\n$`,
+			},
+			{
+				description: "Key the record never had",
+				path:        "/api/v2/records/1/keys/payroll/history",
+				wantStatus:  http.StatusOK,
+				wantBody:    `^\{"id":1,"key":"payroll","intervals":\[\]\}\n$`,
+			},
+			{
+				description: "Record does not exist",
+				path:        "/api/v2/records/2/keys/employee_count/history",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"record of id 2 does not exist"\}\n$`,
+			},
+			{
+				description: "Invalid id",
+				path:        "/api/v2/records/x/keys/employee_count/history",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid id; id must be a positive number"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("GET", tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				require.Regexp(t, tc.wantBody, rr.Body.String())
+			})
+		}
+	})
+}
+
+func Test_FindRecords_V2(t *testing.T) {
+	// the results must only contain the records of this test, so it uses its own database
+	forEachStore(t, filepath.Join(t.TempDir(), "unit-test.db"), func(t *testing.T, router *mux.Router) {
+
+		var before string
+		for i, update := range []struct {
+			method string
+			path   string
+			body   string
+		}{
+			{"POST", "/api/v2/records/1", `{"state":"CA","industry":"construction"}`},
+			{"POST", "/api/v2/records/2", `{"state":"CA","industry":"retail"}`},
+			{"POST", "/api/v2/records/3", `{"state":"NV","industry":"construction","class code":"5403"}`},
+			{"POST", "/api/v2/records/4", `{"state":"CA","industry":"construction"}`},
+			{"POST", "/api/v2/records/1", `{"state":"NV"}`},
+			{"DELETE", "/api/v2/records/4", ``},
+			{"POST", "/api/v3/records/5", `{"state":"WA","employees":120,"insured":true,"address":{"city":"Seattle"}}`},
+		} {
+			if i == 4 {
+				time.Sleep(time.Millisecond)
+				before = time.Now().UTC().Format(time.RFC3339Nano)
+				time.Sleep(time.Millisecond)
+			}
+			req := httptest.NewRequest(update.method, update.path, bytes.NewBuffer([]byte(update.body)))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+		}
+
+		tests := []struct {
+			description string
+			path        string
+			wantStatus  int
+			wantIDs     []int
+			wantBody    string
+		}{
+			{
+				description: "Current versions matching all values",
+				path:        "/api/v2/records?where=state:NV&where=industry:construction",
+				wantStatus:  http.StatusOK,
+				wantIDs:     []int{1, 3},
+			},
+			{
+				description: "Deleted records are left out",
+				path:        "/api/v2/records?where=state:CA",
+				wantStatus:  http.StatusOK,
+				wantIDs:     []int{2},
+			},
+			{
+				description: "Versions current at a time",
+				path:        "/api/v2/records?where=state:CA&at=" + before,
+				wantStatus:  http.StatusOK,
+				wantIDs:     []int{1, 2, 4},
+			},
+			{
+				description: "Key that is not a plain name",
+				path:        "/api/v2/records?where=" + url.QueryEscape("class code:5403"),
+				wantStatus:  http.StatusOK,
+				wantIDs:     []int{3},
+			},
+			{
+				description: "Typed values compared as v2 shows them",
+				path:        "/api/v2/records?where=employees:120&where=insured:true&where=" + url.QueryEscape(`address:{"city":"Seattle"}`),
+				wantStatus:  http.StatusOK,
+				wantIDs:     []int{5},
+			},
+			{
+				description: "Typed value compared as text",
+				path:        "/api/v2/records?where=employees:120.0",
+				wantStatus:  http.StatusOK,
+				wantIDs:     []int{},
+			},
+			{
+				description: "Value containing a colon",
+				path:        "/api/v2/records?where=state:CA:NV",
+				wantStatus:  http.StatusOK,
+				wantIDs:     []int{},
+			},
+			{
+				description: "Missing where",
+				path:        "/api/v2/records",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid where; at least one where=\{key\}:\{value\} is required"\}\n$`,
+			},
+			{
+				description: "Where without a key",
+				path:        "/api/v2/records?where=CA",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid where; where must be \{key\}:\{value\} with a key without double quotes"\}\n$`,
+			},
+			{
+				description: "Key given different values",
+				path:        "/api/v2/records?where=state:CA&where=state:NV",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid where; key state is given different values"\}\n$`,
+			},
+			{
+				description: "Invalid at",
+				path:        "/api/v2/records?where=state:CA&at=yesterday",
+				wantStatus:  http.StatusBadRequest,
+				wantBody:    `^\{"error":"invalid at; at must be an RFC3339 timestamp"\}\n$`,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.description, func(t *testing.T) {
+				req := httptest.NewRequest("GET", tc.path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, tc.wantStatus, rr.Code)
+				if tc.wantIDs == nil {
+					require.Regexp(t, tc.wantBody, rr.Body.String())
+					return
+				}
+
+				require.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+				ids := []int{}
+				decoder := json.NewDecoder(rr.Body)
+				for decoder.More() {
+					var record entity.PersistentRecord
+					require.NoError(t, decoder.Decode(&record))
+					ids = append(ids, record.ID)
+				}
+				require.Equal(t, tc.wantIDs, ids)
+				require.Equal(t, "complete", rr.Result().Trailer.Get("X-Stream-Status"))
+			})
+		}
+	})
+}
+
+func Test_SearchRecords_V2(t *testing.T) {
+	// the results must only contain the records of this test, so it uses its own database
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
 
 	db, err := dbutils.InitDB(filename)
 	if err != nil {
@@ -252,6 +2163,31 @@ func Test_GET_Routes_V2(t *testing.T) {
 	app := NewAPI(nil, nil, db)
 	router := app.SetupRouter(db)
 
+	if available, err := dbutils.SearchAvailable(db); err != nil || !available {
+		req := httptest.NewRequest("GET", "/api/v2/search?q=roofing", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNotImplemented, rr.Code)
+		t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+	}
+
+	for _, update := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"POST", "/api/v2/records/1", `{"description":"Residential roofing contractor"}`},
+		{"POST", "/api/v2/records/2", `{"description":"Bakery","notes":"no roofing work"}`},
+		{"POST", "/api/v2/records/1", `{"description":"Commercial painting contractor"}`},
+		{"POST", "/api/v2/records/3", `{"description":"Roofing supplies wholesaler"}`},
+		{"DELETE", "/api/v2/records/3", ``},
+	} {
+		req := httptest.NewRequest(update.method, update.path, bytes.NewBuffer([]byte(update.body)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
 	tests := []struct {
 		description string
 		path        string
@@ -259,34 +2195,52 @@ func Test_GET_Routes_V2(t *testing.T) {
 		wantBody    string
 	}{
 		{
-			description: "Health check",
-			path:        "/health",
+			description: "Current versions",
+			path:        "/api/v2/search?q=roofing",
 			wantStatus:  http.StatusOK,
-			wantBody:    "{\"ok\":true}\n",
+			wantBody:    `^\[\{"id":2,"version":1,"snippet":"Bakery no \\u003cmark\\u003eroofing\\u003c/mark\\u003e work"\}\]\n$`,
 		},
 		{
-			description: "Get non-existent record",
-			path:        "/api/v2/records/15",
+			description: "Every version",
+			path:        "/api/v2/search?q=roofing&history=true",
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\[(\{"id":\d,"version":1,"snippet":"[^"]*\\u003cmark\\u003e[Rr]oofing\\u003c/mark\\u003e[^"]*"\},?){3}\]\n$`,
+		},
+		{
+			description: "Prefix query and limit",
+			path:        "/api/v2/search?q=contract*&limit=1",
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\[\{"id":1,"version":2,"snippet":"Commercial painting \\u003cmark\\u003econtractor\\u003c/mark\\u003e"\}\]\n$`,
+		},
+		{
+			description: "No match",
+			path:        "/api/v2/search?q=aviation",
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\[\]\n$`,
+		},
+		{
+			description: "Missing query",
+			path:        "/api/v2/search",
 			wantStatus:  http.StatusBadRequest,
-			wantBody:    "{\"error\":\"record of id 15 does not exist\"}\n",
+			wantBody:    `^\{"error":"invalid q; q must be a search query"\}\n$`,
 		},
 		{
-			description: "Get record with negative id",
-			path:        "/api/v2/records/-1",
+			description: "Invalid query syntax",
+			path:        "/api/v2/search?q=" + url.QueryEscape(`"roofing`),
 			wantStatus:  http.StatusBadRequest,
-			wantBody:    "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			wantBody:    `^\{"error":"invalid q; q is not a valid full-text query"\}\n$`,
 		},
 		{
-			description: "Invalid id (non-numeric)",
-			path:        "/api/v2/records/abc",
+			description: "History combined with at",
+			path:        "/api/v2/search?q=roofing&history=true&at=2026-01-01T00:00:00Z",
 			wantStatus:  http.StatusBadRequest,
-			wantBody:    "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			wantBody:    `^\{"error":"invalid history; history must be true or false, and not be combined with at"\}\n$`,
 		},
 		{
-			description: "Get non-existent record list",
-			path:        "/api/v2/records/15/list",
+			description: "Invalid limit",
+			path:        "/api/v2/search?q=roofing&limit=0",
 			wantStatus:  http.StatusBadRequest,
-			wantBody:    "{\"error\":\"record of id 15 does not exist\"}\n",
+			wantBody:    `^\{"error":"invalid limit; limit must be a number from 1 to 1000"\}\n$`,
 		},
 	}
 
@@ -297,13 +2251,14 @@ func Test_GET_Routes_V2(t *testing.T) {
 			router.ServeHTTP(rr, req)
 
 			require.Equal(t, tc.wantStatus, rr.Code)
-			require.Equal(t, tc.wantBody, rr.Body.String())
+			require.Regexp(t, tc.wantBody, rr.Body.String())
 		})
 	}
 }
 
-func Test_POST_Routes_V2(t *testing.T) {
-	filename := "unit-test.db"
+func Test_VerifyRecord_V2(t *testing.T) {
+	// the history is edited out of band, so this test uses its own database
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
 
 	db, err := dbutils.InitDB(filename)
 	if err != nil {
@@ -319,67 +2274,94 @@ func Test_POST_Routes_V2(t *testing.T) {
 	app := NewAPI(nil, nil, db)
 	router := app.SetupRouter(db)
 
+	for _, body := range []string{`{"limit":"1000"}`, `{"limit":"2000"}`, `{"limit":"3000"}`} {
+		req := httptest.NewRequest("POST", "/api/v2/records/1", bytes.NewBuffer([]byte(body)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	tamper := func(statement string) func(t *testing.T) {
+		return func(t *testing.T) {
+			_, err := db.Exec(statement)
+			require.NoError(t, err)
+		}
+	}
+
 	tests := []struct {
 		description string
-		body        string // needed for POST requests only; can be empty for GET requests
 		path        string
+		tamper      func(t *testing.T) // edits the history before the request
 		wantStatus  int
-		PostResBody string
-		GetResBody  string
+		wantBody    string
 	}{
 		{
-			description: "Post to negative id",
-			body:        "{\"key1\":\"value1\",\"key2\":\"222\"}",
-			path:        "/api/v2/records/-11",
-			wantStatus:  http.StatusBadRequest,
-			PostResBody: "{\"error\":\"invalid id; id must be a positive number\"}\n",
-			GetResBody:  "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			description: "Untouched history",
+			path:        "/api/v2/records/1/verify",
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\{"id":1,"versions":3,"valid":true,"hash":"[0-9a-f]{64}"\}\n$`,
 		},
 		{
-			description: "Post to invalid id (non-numeric)",
-			body:        "{\"key1\":\"value1\",\"key2\":\"222\"}",
-			path:        "/api/v2/records/abc",
-			wantStatus:  http.StatusBadRequest,
-			PostResBody: "{\"error\":\"invalid id; id must be a positive number\"}\n",
-			GetResBody:  "{\"error\":\"invalid id; id must be a positive number\"}\n",
+			description: "Edited change metadata",
+			path:        "/api/v2/records/1/verify",
+			tamper:      tamper(`UPDATE records SET author = 'mallory', deleted = 1 WHERE id = 1 AND version = 3`),
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\{"id":1,"versions":3,"valid":false,"hash":"[0-9a-f]{64}","broken_version":3,"error":"version 3 does not match its hash"\}\n$`,
 		},
 		{
-			description: "Post invalid json body",
-			body:        "[{\"key1\":}]",
-			path:        "/api/v2/records/18",
+			description: "Edited data",
+			path:        "/api/v2/records/1/verify",
+			tamper:      tamper(`UPDATE records SET data = '{"limit":"9000"}' WHERE id = 1 AND version = 2`),
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\{"id":1,"versions":3,"valid":false,"hash":"[0-9a-f]{64}","broken_version":2,"error":"version 2 does not match its hash"\}\n$`,
+		},
+		{
+			description: "Edited data with a recomputed hash",
+			path:        "/api/v2/records/1/verify",
+			tamper: func(t *testing.T) {
+				first, err := dbutils.ReadOneVersion(db, 1, 1)
+				require.NoError(t, err)
+				second, err := dbutils.ReadOneVersion(db, 1, 2)
+				require.NoError(t, err)
+				tamper(`UPDATE records SET hash = '` + storage.HashVersion(*second, first.Hash) + `' WHERE id = 1 AND version = 2`)(t)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `^\{"id":1,"versions":3,"valid":false,"hash":"[0-9a-f]{64}","broken_version":3,"error":"version 3 does not match its hash"\}\n$`,
+		},
+		{
+			description: "Removed version",
+			path:        "/api/v2/records/1/verify",
+			tamper:      tamper(`DELETE FROM records WHERE id = 1 AND version = 2`),
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\{"id":1,"versions":2,"valid":false,"hash":"[0-9a-f]{64}","broken_version":3,"error":"version 3 follows version 1"\}\n$`,
+		},
+		{
+			description: "Record does not exist",
+			path:        "/api/v2/records/2/verify",
 			wantStatus:  http.StatusBadRequest,
-			PostResBody: "{\"error\":\"invalid input; could not parse json\"}\n",
-			GetResBody:  "{\"error\":\"record of id 18 does not exist\"}\n",
+			wantBody:    `^\{"error":"record of id 2 does not exist"\}\n$`,
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.description, func(t *testing.T) {
-			jsonBody := []byte(tc.body)
-			body := bytes.NewBuffer(jsonBody)
-
-			reqPost := httptest.NewRequest("POST", tc.path, body)
-			reqPost.Header.Set("Content-Type", "application/json")
-			rrPost := httptest.NewRecorder()
-			router.ServeHTTP(rrPost, reqPost)
-
-			require.Equal(t, tc.wantStatus, rrPost.Code)
-			require.Regexp(t, tc.PostResBody, rrPost.Body.String())
+			if tc.tamper != nil {
+				tc.tamper(t)
+			}
 
-			// every POST request is followed by a GET request to ensure that the record was actually created
-			// and returns same exact body as the POST request
-			reqGet := httptest.NewRequest("GET", tc.path, nil)
-			rrGet := httptest.NewRecorder()
-			router.ServeHTTP(rrGet, reqGet)
+			req := httptest.NewRequest("GET", tc.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
 
-			require.Equal(t, tc.wantStatus, rrGet.Code)
-			require.Regexp(t, tc.GetResBody, rrGet.Body.String())
+			require.Equal(t, tc.wantStatus, rr.Code)
+			require.Regexp(t, tc.wantBody, rr.Body.String())
 		})
 	}
 }
 
-func Test_ListVersions_V2(t *testing.T) {
-	filename := "unit-test.db"
+func Test_Checkpoints_V2(t *testing.T) {
+	// the checkpoints cover every version of a day, so this test uses its own database
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
 
 	db, err := dbutils.InitDB(filename)
 	if err != nil {
@@ -395,64 +2377,95 @@ func Test_ListVersions_V2(t *testing.T) {
 	app := NewAPI(nil, nil, db)
 	router := app.SetupRouter(db)
 
+	lines := `{"id":1,"version":1,"start":"20260105090000000000000","end":"20260105100000000000000","data":{"a":"1"}}
+{"id":1,"version":2,"start":"20260105100000000000000","data":{"a":"2"}}
+{"id":2,"version":1,"start":"20260105110000000000000","data":{"b":"1"}}
+`
+	req := httptest.NewRequest("POST", "/api/v2/import", bytes.NewBuffer([]byte(lines)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	req = httptest.NewRequest("POST", "/api/v2/records/3", bytes.NewBuffer([]byte(`{"c":"1"}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	records := service.NewPersistentRecordService(dbutils.NewStore(db))
+	_, err = records.CreateCheckpoints(context.Background(), key, time.Now())
+	require.NoError(t, err)
+
+	checkpoint := `\{"day":"20260105","leaves":3,"root":"[0-9a-f]{64}","created":"\d{23}","signature":"[0-9a-f]{128}","public_key":"[0-9a-f]{64}"\}`
 	tests := []struct {
 		description string
-		body        string
+		method      string
 		path        string
-		PostStatus  int
-		GetStatus   int
-		PostResBody string
-		GetResBody  string
+		body        string
+		wantStatus  int
+		wantBody    string
 	}{
 		{
-			description: "Post new record",
-			body:        "{\"key1\":\"value1\",\"key2\":\"222\",\"status\":null}",
-			path:        "/api/v2/records/1",
-			PostStatus:  http.StatusOK,
-			GetStatus:   http.StatusOK,
-			PostResBody: `^\{"id":1,"version":\d+,"start":"\d+","data":\{"key1":"value1","key2":"222"\}\}\n$`,
-			GetResBody:  `^\{"id":1,"version":\d+,"start":"\d+","data":\{"key1":"value1","key2":"222"\}\}\n$`,
+			description: "Checkpoint of a day",
+			method:      "GET",
+			path:        "/api/v2/checkpoints/20260105",
+			wantStatus:  http.StatusOK,
+			wantBody:    `^` + checkpoint + `\n$`,
 		},
 		{
-			description: "Update existing record",
-			body:        "{\"key1\":\"value2\",\"status\":\"ok\"}",
-			path:        "/api/v2/records/1",
-			PostStatus:  http.StatusOK,
-			GetStatus:   http.StatusOK,
-			PostResBody: `^\{"id":1,"version":\d+,"start":"\d+","data":\{"key1":"value2","key2":"222","status":"ok"\}\}\n$`,
-			GetResBody:  `^\{"id":1,"version":\d+,"start":"\d+","data":\{"key1":"value2","key2":"222","status":"ok"\}\}\n$`,
+			description: "Inclusion proof",
+			method:      "GET",
+			path:        "/api/v2/records/1/versions/2/proof",
+			wantStatus:  http.StatusOK,
+			wantBody: `^\{"id":1,"version":2,"leaf":"\[1,2,\\"20260105100000000000000\\",\\"20260105100000000000000\\",\\"\\",\\"\{\\\\\\"a\\\\\\":\\\\\\"2\\\\\\"\}\\",\\"\\",0,false,\\"\\",\\"\\",\\"\\"\]",` +
+				`"leaf_hash":"[0-9a-f]{64}","leaf_index":1,"proof":\["[0-9a-f]{64}","[0-9a-f]{64}"\],"checkpoint":` + checkpoint + `\}\n$`,
+		},
+		{
+			description: "Version written today",
+			method:      "GET",
+			path:        "/api/v2/records/3/versions/1/proof",
+			wantStatus:  http.StatusNotFound,
+			wantBody:    `^\{"error":"record of id 3 version 1 is not checkpointed yet"\}\n$`,
 		},
 		{
-			description: "list all existing versions of a record",
-			body:        "{}",
-			path:        "/api/v2/records/1/list",
-			PostStatus:  http.StatusMethodNotAllowed,
-			GetStatus:   http.StatusOK,
-			PostResBody: `^.*$`, // POST request to list endpoint is not be allowed, so response body can be anything
-			GetResBody:  `{"records":\[{"id":1,"version":[\s\S]*`,
+			description: "Version does not exist",
+			method:      "GET",
+			path:        "/api/v2/records/2/versions/2/proof",
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    `^\{"error":"record of id 2 version 2 does not exist"\}\n$`,
+		},
+		{
+			description: "Day without checkpoint",
+			method:      "GET",
+			path:        "/api/v2/checkpoints/20260104",
+			wantStatus:  http.StatusNotFound,
+			wantBody:    `^\{"error":"day 20260104 has no checkpoint"\}\n$`,
+		},
+		{
+			description: "Invalid day",
+			method:      "GET",
+			path:        "/api/v2/checkpoints/2026-01-05",
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    `^\{"error":"invalid day; day must be a date as YYYYMMDD"\}\n$`,
+		},
+		{
+			description: "Import into a checkpointed day",
+			method:      "POST",
+			path:        "/api/v2/import",
+			body:        `{"id":2,"version":2,"start":"20260105120000000000000","data":{"b":"2"}}`,
+			wantStatus:  http.StatusOK,
+			wantBody:    `^\{"dry_run":false,"imported":0,"failed":1,"errors":\[\{"line":1,"error":"version 2 of record 2 starts on 20260105, which is already checkpointed"\}\]\}\n$`,
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.description, func(t *testing.T) {
-			jsonBody := []byte(tc.body)
-			body := bytes.NewBuffer(jsonBody)
-
-			reqPost := httptest.NewRequest("POST", tc.path, body)
-			reqPost.Header.Set("Content-Type", "application/json")
-			rrPost := httptest.NewRecorder()
-			router.ServeHTTP(rrPost, reqPost)
-
-			require.Equal(t, tc.PostStatus, rrPost.Code)
-			require.Regexp(t, tc.PostResBody, rrPost.Body.String())
-
-			// every POST request is followed by a GET request to same path
-			reqGet := httptest.NewRequest("GET", tc.path, nil)
-			rrGet := httptest.NewRecorder()
-			router.ServeHTTP(rrGet, reqGet)
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBuffer([]byte(tc.body)))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
 
-			require.Equal(t, tc.GetStatus, rrGet.Code)
-			require.Regexp(t, tc.GetResBody, rrGet.Body.String())
+			require.Equal(t, tc.wantStatus, rr.Code)
+			require.Regexp(t, tc.wantBody, rr.Body.String())
 		})
 	}
 }
@@ -502,5 +2515,5 @@ func Benchmark_POST_Routes_V2(b *testing.B) {
 	router.ServeHTTP(rrGet, reqGet)
 
 	require.Equal(b, http.StatusOK, rrGet.Code)
-	require.Regexp(b, `^\{"id":99,"version":\d+,"start":"\d+","data":\{"key10000":"value10000"\}\}\n$`, rrGet.Body.String())
+	require.Regexp(b, `^\{"id":99,"version":\d+,"start":"\d+","valid_from":"\d+","data":\{"key10000":"value10000"\}\}\n$`, rrGet.Body.String())
 }
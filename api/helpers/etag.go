@@ -0,0 +1,127 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidIfMatch = errors.New("invalid If-Match header")
+
+// SetETag sets the ETag header, derived from the version of a record.
+func SetETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// IfMatch is the precondition of an If-Match header (RFC 9110, section 13.1.1).
+type IfMatch struct {
+	// Present is set when the request has an If-Match header.
+	Present bool
+	// Any is set for If-Match: *, which holds for a record that exists.
+	Any bool
+	// Versions are the versions named by the strong entity tags of the header. If-Match compares strongly, so
+	// weak tags and tags that are not the ETag of any version never match and are left out.
+	Versions []int
+}
+
+// NeverHolds reports whether the header lists only entity tags that no version can match.
+func (m IfMatch) NeverHolds() bool {
+	return m.Present && !m.Any && len(m.Versions) == 0
+}
+
+// Failure describes why the record of the id does not meet the precondition.
+func (m IfMatch) Failure(id int64) string {
+	switch {
+	case m.Any:
+		return fmt.Sprintf("precondition failed; record of id %v does not exist", id)
+	case len(m.Versions) == 0:
+		return fmt.Sprintf("precondition failed; If-Match names no version of record of id %v", id)
+	case len(m.Versions) == 1:
+		return fmt.Sprintf("precondition failed; record of id %v is no longer at version %v", id, m.Versions[0])
+	}
+	versions := make([]string, len(m.Versions))
+	for i, version := range m.Versions {
+		versions[i] = strconv.Itoa(version)
+	}
+	return fmt.Sprintf("precondition failed; record of id %v is at none of the versions %v", id, strings.Join(versions, ", "))
+}
+
+// ParseIfMatch parses the If-Match headers of the request, each either * or a comma-separated list of entity tags.
+func ParseIfMatch(r *http.Request) (IfMatch, error) {
+	headers := r.Header.Values("If-Match")
+	if len(headers) == 0 {
+		return IfMatch{}, nil
+	}
+
+	ifMatch := IfMatch{Present: true}
+	for _, header := range headers {
+		if strings.TrimSpace(header) == "*" {
+			ifMatch.Any = true
+			continue
+		}
+		tags, err := parseEntityTags(header)
+		if err != nil {
+			return IfMatch{}, err
+		}
+		for _, tag := range tags {
+			if tag.weak {
+				continue
+			}
+			version, err := strconv.ParseInt(tag.opaque, 10, 32)
+			if err != nil || version <= 0 || strconv.FormatInt(version, 10) != tag.opaque {
+				continue
+			}
+			ifMatch.Versions = append(ifMatch.Versions, int(version))
+		}
+	}
+	return ifMatch, nil
+}
+
+type entityTag struct {
+	weak   bool
+	opaque string
+}
+
+// parseEntityTags parses a comma-separated list of entity tags. Empty list elements are allowed, as in every list
+// of RFC 9110; an opaque tag may contain commas.
+func parseEntityTags(list string) ([]entityTag, error) {
+	var tags []entityTag
+	rest := list
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+
+		tag := entityTag{}
+		if strings.HasPrefix(rest, "W/") {
+			tag.weak = true
+			rest = rest[len("W/"):]
+		}
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, ErrInvalidIfMatch
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return nil, ErrInvalidIfMatch
+		}
+		tag.opaque = rest[1 : end+1]
+		for _, c := range []byte(tag.opaque) {
+			if c < 0x21 || c == 0x7f {
+				return nil, ErrInvalidIfMatch
+			}
+		}
+		tags = append(tags, tag)
+
+		rest = strings.TrimLeft(rest[end+2:], " \t")
+		if rest != "" && rest[0] != ',' {
+			return nil, ErrInvalidIfMatch
+		}
+	}
+	if len(tags) == 0 {
+		return nil, ErrInvalidIfMatch
+	}
+	return tags, nil
+}
@@ -5,6 +5,10 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/regr76/timetravel/entity"
 )
 
 var (
@@ -35,3 +39,33 @@ func WriteError(w http.ResponseWriter, message string, statusCode int) error {
 		statusCode,
 	)
 }
+
+// WriteFieldErrors writes the message as an error, together with the field-level errors that caused it.
+func WriteFieldErrors(w http.ResponseWriter, message string, fields []entity.FieldError, statusCode int) error {
+	return WriteJSON(
+		w,
+		struct {
+			Error  string              `json:"error"`
+			Fields []entity.FieldError `json:"fields"`
+		}{message, fields},
+		statusCode,
+	)
+}
+
+// ParseTimeParam parses an optional RFC3339 query parameter; the zero time is returned when it is absent.
+func ParseTimeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ParseChangeHeaders returns the author, reason and source of a change from the
+// X-Change-Author, X-Change-Reason and X-Change-Source headers; absent headers are empty.
+func ParseChangeHeaders(r *http.Request) (author string, reason string, source string) {
+	author = strings.TrimSpace(r.Header.Get("X-Change-Author"))
+	reason = strings.TrimSpace(r.Header.Get("X-Change-Reason"))
+	source = strings.TrimSpace(r.Header.Get("X-Change-Source"))
+	return author, reason, source
+}
@@ -0,0 +1,82 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// DELETE /records/{id}
+// DeleteRecord closes the record with a tombstone version, which is returned.
+// Afterwards GET /records/{id} answers 410 Gone, while the versions and the list still show the history;
+// POST /records/{id} brings the record back. An If-Match header makes the delete conditional,
+// and the X-Change-* headers are stored with the tombstone.
+func DeleteRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		err := helpers.WriteError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	ifMatch, err := helpers.ParseIfMatch(r)
+	if err != nil {
+		err := helpers.WriteError(w, "invalid If-Match; expected * or a list of entity tags", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if ifMatch.NeverHolds() {
+		err := helpers.WriteError(w, ifMatch.Failure(idNumber), http.StatusPreconditionFailed)
+		helpers.LogError(err)
+		return
+	}
+
+	author, reason, source := helpers.ParseChangeHeaders(r)
+	opts := service.UpdateOptions{
+		ExpectedVersions: ifMatch.Versions,
+		MustExist:        ifMatch.Any,
+		Author:           author,
+		Reason:           reason,
+		Source:           source,
+	}
+	record, err := a.PersistentRecords().DeleteRecord(ctx, int(idNumber), opts)
+	if errors.Is(err, service.ErrRecordDoesNotExist) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v does not exist", idNumber), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrRecordDeleted) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v has been deleted", idNumber), http.StatusGone)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrConcurrentUpdate) {
+		err := helpers.WriteError(w, err.Error(), http.StatusConflict)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrVersionConflict) {
+		err := helpers.WriteError(w, ifMatch.Failure(idNumber), http.StatusPreconditionFailed)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	setETag(w, record)
+	err = helpers.WriteJSON(w, record, http.StatusOK)
+	helpers.LogError(err)
+}
@@ -0,0 +1,62 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /records/{id}/diff?from={version}&to={version}
+// DiffVersions returns the keys added, removed and changed between two versions of the record.
+func DiffVersions(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+	fromNumber, err1 := strconv.ParseInt(r.URL.Query().Get("from"), 10, 32)
+	toNumber, err2 := strconv.ParseInt(r.URL.Query().Get("to"), 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		err := helpers.WriteError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	if err1 != nil || fromNumber <= 0 {
+		err := helpers.WriteError(w, "invalid from; from must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	if err2 != nil || toNumber <= 0 {
+		err := helpers.WriteError(w, "invalid to; to must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	diff, err := a.PersistentRecords().DiffVersions(
+		ctx,
+		int(idNumber),
+		int(fromNumber),
+		int(toNumber),
+	)
+	if errors.Is(err, service.ErrVersionDoesNotExist) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v does not have versions %v and %v", idNumber, fromNumber, toNumber), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	err = helpers.WriteJSON(w, diff, http.StatusOK)
+	helpers.LogError(err)
+}
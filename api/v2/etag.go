@@ -0,0 +1,15 @@
+package v2
+
+import (
+	"net/http"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
+)
+
+// setETag sets the ETag header, derived from the version of the record.
+func setETag(w http.ResponseWriter, record entity.Record) {
+	if versioned, ok := record.(*entity.PersistentRecord); ok {
+		helpers.SetETag(w, versioned.GetVersion())
+	}
+}
@@ -0,0 +1,58 @@
+package v2
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /export
+// GET /export?from_id={id}&to_id={id}&since={RFC3339 timestamp}&until={RFC3339 timestamp}
+// Export streams every version of every record as newline-delimited JSON, in ascending (id, version) order.
+// from_id/to_id restrict the ids (inclusive), since/until the versions current at some point in [since, until).
+func Export(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filter := service.ExportFilter{}
+
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{
+		{"from_id", &filter.FromID},
+		{"to_id", &filter.ToID},
+	} {
+		name := param.name
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		idNumber, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || idNumber <= 0 {
+			err := helpers.WriteError(w, "invalid "+name+"; "+name+" must be a positive number", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+		*param.target = int(idNumber)
+	}
+
+	var err error
+	filter.Since, err = helpers.ParseTimeParam(r, "since")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid since; since must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	filter.Until, err = helpers.ParseTimeParam(r, "until")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid until; until must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	streamRecords(w, func(yield func(*entity.PersistentRecord) error) error {
+		return a.PersistentRecords().ExportRecords(ctx, filter, yield)
+	})
+}
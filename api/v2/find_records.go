@@ -0,0 +1,51 @@
+package v2
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /records?where={key}:{value}&where={key}:{value}&at={RFC3339 timestamp}
+// FindRecords streams, as newline-delimited JSON, every record whose current version (or the version current
+// at the given time) has all the given values.
+func FindRecords(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	conditions := r.URL.Query()["where"]
+	if len(conditions) == 0 {
+		err := helpers.WriteError(w, "invalid where; at least one where={key}:{value} is required", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	where := map[string]string{}
+	for _, condition := range conditions {
+		key, value, ok := strings.Cut(condition, ":")
+		if !ok || key == "" || strings.Contains(key, `"`) {
+			err := helpers.WriteError(w, "invalid where; where must be {key}:{value} with a key without double quotes", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+		if previous, ok := where[key]; ok && previous != value {
+			err := helpers.WriteError(w, "invalid where; key "+key+" is given different values", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+		where[key] = value
+	}
+
+	at, err := helpers.ParseTimeParam(r, "at")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid at; at must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	streamRecords(w, func(yield func(*entity.PersistentRecord) error) error {
+		return a.PersistentRecords().FindRecords(ctx, where, at, yield)
+	})
+}
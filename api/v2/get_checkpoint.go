@@ -0,0 +1,42 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /checkpoints/{day}
+// GetCheckpoint returns the signed Merkle root over the versions written on the day (UTC, YYYYMMDD).
+func GetCheckpoint(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	day := mux.Vars(r)["day"]
+
+	if _, err := time.Parse("20060102", day); err != nil {
+		err := helpers.WriteError(w, "invalid day; day must be a date as YYYYMMDD", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	checkpoint, err := a.PersistentRecords().GetCheckpoint(ctx, day)
+	if errors.Is(err, service.ErrCheckpointDoesNotExist) {
+		err := helpers.WriteError(w, fmt.Sprintf("day %v has no checkpoint", day), http.StatusNotFound)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	err = helpers.WriteJSON(w, checkpoint, http.StatusOK)
+	helpers.LogError(err)
+}
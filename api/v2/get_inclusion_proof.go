@@ -0,0 +1,62 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /records/{id}/versions/{version}/proof
+// GetInclusionProof returns the proof that the version is part of the signed checkpoint of the day it was written,
+// which an auditor can check against the checkpoint without access to any other version.
+func GetInclusionProof(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	version := mux.Vars(r)["version"]
+	idNumber, err1 := strconv.ParseInt(id, 10, 32)
+	versionNumber, err2 := strconv.ParseInt(version, 10, 32)
+
+	if err1 != nil || idNumber <= 0 {
+		err := helpers.WriteError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	if err2 != nil || versionNumber <= 0 {
+		err := helpers.WriteError(w, "invalid version; version must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	proof, err := a.PersistentRecords().GetInclusionProof(ctx, int(idNumber), int(versionNumber))
+	if errors.Is(err, service.ErrVersionDoesNotExist) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v version %v does not exist", idNumber, versionNumber), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrCheckpointDoesNotExist) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v version %v is not checkpointed yet", idNumber, versionNumber), http.StatusNotFound)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrCheckpointMismatch) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v version %v: %v", idNumber, versionNumber, err), http.StatusConflict)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	err = helpers.WriteJSON(w, proof, http.StatusOK)
+	helpers.LogError(err)
+}
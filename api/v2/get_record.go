@@ -1,18 +1,26 @@
 package v2
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
 	"github.com/regr76/timetravel/service"
 )
 
 // GET /records/{id}
-// GetRecord retrieves the record.
+// GET /records/{id}?at={RFC3339 timestamp}
+// GET /records/{id}?known_at={RFC3339 timestamp}&valid_at={RFC3339 timestamp}
+// GetRecord retrieves the record (the version valid now as known now, the version current at the given time,
+// or the version that as known at known_at was valid at valid_at). The version valid now is the one plain
+// updates build on and If-Match is checked against.
+// A record that has been deleted (at that time) is reported with 410 Gone.
 func GetRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id := mux.Vars(r)["id"]
@@ -25,16 +33,112 @@ func GetRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record, err := a.PersistentRecords().GetRecord(
-		ctx,
-		int(idNumber),
-	)
+	at, err := helpers.ParseTimeParam(r, "at")
 	if err != nil {
-		err := helpers.WriteError(w, fmt.Sprintf("record of id %v does not exist", idNumber), http.StatusBadRequest)
+		err := helpers.WriteError(w, "invalid at; at must be an RFC3339 timestamp", http.StatusBadRequest)
 		helpers.LogError(err)
 		return
 	}
+	knownAt, err := helpers.ParseTimeParam(r, "known_at")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid known_at; known_at must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	validAt, err := helpers.ParseTimeParam(r, "valid_at")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid valid_at; valid_at must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	var record entity.Record
+	switch {
+	case !at.IsZero() && (!knownAt.IsZero() || !validAt.IsZero()):
+		err := helpers.WriteError(w, "invalid query; at cannot be combined with known_at or valid_at", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+
+	case !at.IsZero():
+		record, err = a.PersistentRecords().GetRecordAt(
+			ctx,
+			int(idNumber),
+			at,
+		)
+		if errors.Is(err, service.ErrRecordDeleted) {
+			err := helpers.WriteError(w, fmt.Sprintf("record of id %v was deleted at %v", idNumber, r.URL.Query().Get("at")), http.StatusGone)
+			helpers.LogError(err)
+			return
+		}
+		if errors.Is(err, service.ErrRecordDoesNotExist) {
+			err := helpers.WriteError(w, fmt.Sprintf("record of id %v does not exist at %v", idNumber, r.URL.Query().Get("at")), http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+		if err != nil {
+			errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+			helpers.LogError(err)
+			helpers.LogError(errInWriting)
+			return
+		}
+
+	case !knownAt.IsZero() || !validAt.IsZero():
+		// a missing side of the bitemporal query defaults to now
+		now := time.Now()
+		if knownAt.IsZero() {
+			knownAt = now
+		}
+		if validAt.IsZero() {
+			validAt = now
+		}
+
+		record, err = a.PersistentRecords().GetRecordAsOf(
+			ctx,
+			int(idNumber),
+			knownAt,
+			validAt,
+		)
+		if errors.Is(err, service.ErrRecordDeleted) {
+			err := helpers.WriteError(w, fmt.Sprintf("record of id %v was known at %v to be deleted at %v", idNumber, knownAt.Format(time.RFC3339), validAt.Format(time.RFC3339)), http.StatusGone)
+			helpers.LogError(err)
+			return
+		}
+		if errors.Is(err, service.ErrRecordDoesNotExist) {
+			err := helpers.WriteError(w, fmt.Sprintf("record of id %v was not known at %v to be valid at %v", idNumber, knownAt.Format(time.RFC3339), validAt.Format(time.RFC3339)), http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+		if err != nil {
+			errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+			helpers.LogError(err)
+			helpers.LogError(errInWriting)
+			return
+		}
+
+	default:
+		record, err = a.PersistentRecords().GetRecord(
+			ctx,
+			int(idNumber),
+		)
+		if errors.Is(err, service.ErrRecordDeleted) {
+			err := helpers.WriteError(w, fmt.Sprintf("record of id %v has been deleted", idNumber), http.StatusGone)
+			helpers.LogError(err)
+			return
+		}
+		if errors.Is(err, service.ErrRecordDoesNotExist) {
+			err := helpers.WriteError(w, fmt.Sprintf("record of id %v does not exist", idNumber), http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+		if err != nil {
+			errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+			helpers.LogError(err)
+			helpers.LogError(errInWriting)
+			return
+		}
+	}
 
+	setETag(w, record)
 	err = helpers.WriteJSON(w, record, http.StatusOK)
 	helpers.LogError(err)
 }
@@ -0,0 +1,45 @@
+package v2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /schemas/{type}
+// GET /schemas/{type}/versions/{version}
+// GetSchema retrieves the latest or a specific version of the schema of a record type.
+func GetSchema(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	recordType := mux.Vars(r)["type"]
+
+	versionNumber := int64(0)
+	if version, ok := mux.Vars(r)["version"]; ok {
+		var err error
+		versionNumber, err = strconv.ParseInt(version, 10, 32)
+		if err != nil || versionNumber <= 0 {
+			err := helpers.WriteError(w, "invalid version; version must be a positive number", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+	}
+
+	schema, err := a.PersistentRecords().GetSchema(
+		ctx,
+		recordType,
+		int(versionNumber),
+	)
+	if err != nil {
+		err := helpers.WriteError(w, fmt.Sprintf("schema of type %v does not exist", recordType), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, schema, http.StatusOK)
+	helpers.LogError(err)
+}
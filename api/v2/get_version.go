@@ -43,6 +43,7 @@ func GetVersion(a service.Storage, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, record)
 	err = helpers.WriteJSON(w, record, http.StatusOK)
 	helpers.LogError(err)
 }
@@ -0,0 +1,92 @@
+package v2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/service"
+)
+
+// maxImportLineSize is the size of the longest line accepted by an import.
+const maxImportLineSize = 16 << 20
+
+var errEmptyLine = errors.New("empty line")
+
+// POST /import
+// POST /import?dry_run=true
+// ImportRecords replays versioned history sent as newline-delimited JSON, one
+// {"id", "version", "start", "end", "valid_from", "valid_to", "data"} version per line (the export format).
+// Lines that fail validation are reported and skipped; with dry_run nothing is written. When the import stops on an
+// internal error the batches written before it stay imported, so the result is returned with status 500.
+func ImportRecords(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			err := helpers.WriteError(w, "invalid dry_run; dry_run must be true or false", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+	lineCount := 0
+	lines := func(yield func(*entity.PersistentRecord, error) bool) {
+		for scanner.Scan() {
+			lineCount++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				if !yield(nil, errEmptyLine) {
+					return
+				}
+				continue
+			}
+
+			var record entity.PersistentRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				if !yield(nil, fmt.Errorf("could not parse json: %w", err)) {
+					return
+				}
+				continue
+			}
+			if !yield(&record, nil) {
+				return
+			}
+		}
+	}
+
+	result, err := a.PersistentRecords().ImportRecords(ctx, lines, dryRun)
+	if err != nil && result == nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+	if err != nil {
+		result.Error = helpers.ErrInternal.Error()
+		errInWriting := helpers.WriteJSON(w, result, http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	// reading stops at a line that is too long; everything before it has been imported
+	if err := scanner.Err(); err != nil {
+		result.Errors = append(result.Errors, entity.ImportError{Line: lineCount + 1, Error: err.Error()})
+		result.Failed++
+	}
+
+	err = helpers.WriteJSON(w, result, http.StatusOK)
+	helpers.LogError(err)
+}
@@ -0,0 +1,44 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /records/{id}/keys/{key}/history
+// KeyHistory returns every value a key of the record had, with the versions and time during which it held.
+func KeyHistory(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	key := mux.Vars(r)["key"]
+
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := helpers.WriteError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	history, err := a.PersistentRecords().KeyHistory(ctx, int(idNumber), key)
+	if errors.Is(err, service.ErrRecordDoesNotExist) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v does not exist", idNumber), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	err = helpers.WriteJSON(w, history, http.StatusOK)
+	helpers.LogError(err)
+}
@@ -0,0 +1,51 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// PUT /schemas/{type}
+// RegisterSchema stores the JSON Schema in the body as the next version of the schema of the record type.
+// Earlier versions are kept, so existing versions of records stay tied to the schema they were validated against.
+func RegisterSchema(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	recordType := mux.Vars(r)["type"]
+
+	var body json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+
+	if err != nil {
+		err := helpers.WriteError(w, "invalid input; could not parse json", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	schema, err := a.PersistentRecords().RegisterSchema(ctx, recordType, body)
+	if errors.Is(err, service.ErrRecordTypeInvalid) {
+		err := helpers.WriteError(w, "invalid type; type must be lowercase letters, digits and underscores", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrSchemaInvalid) {
+		err := helpers.WriteError(w, fmt.Sprintf("invalid input; %v", err), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	err = helpers.WriteJSON(w, schema, http.StatusOK)
+	helpers.LogError(err)
+}
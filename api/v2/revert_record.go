@@ -0,0 +1,71 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// POST /records/{id}/revert/{version}
+// RevertRecord adds a new version of the record whose data equals the given historical version.
+// The history is left untouched, including the versions being reverted.
+// The X-Change-Author, X-Change-Reason and X-Change-Source headers are stored with the new version.
+func RevertRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	version := mux.Vars(r)["version"]
+	idNumber, err1 := strconv.ParseInt(id, 10, 32)
+	versionNumber, err2 := strconv.ParseInt(version, 10, 32)
+
+	if err1 != nil || idNumber <= 0 {
+		err := helpers.WriteError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	if err2 != nil || versionNumber <= 0 {
+		err := helpers.WriteError(w, "invalid version; version must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	author, reason, source := helpers.ParseChangeHeaders(r)
+	opts := service.UpdateOptions{
+		Author: author,
+		Reason: reason,
+		Source: source,
+	}
+	record, err := a.PersistentRecords().RevertRecord(
+		ctx,
+		int(idNumber),
+		int(versionNumber),
+		opts,
+	)
+	if errors.Is(err, service.ErrVersionDoesNotExist) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v version %v does not exist", idNumber, versionNumber), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		err := helpers.WriteFieldErrors(w, fmt.Sprintf("invalid input; record does not match schema %v version %v", validationErr.RecordType, validationErr.SchemaVersion), validationErr.Fields, http.StatusUnprocessableEntity)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	setETag(w, record)
+	err = helpers.WriteJSON(w, record, http.StatusOK)
+	helpers.LogError(err)
+}
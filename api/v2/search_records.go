@@ -0,0 +1,84 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+const (
+	// defaultSearchLimit and maxSearchLimit bound the number of results of a search.
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+)
+
+// GET /search?q={query}&at={RFC3339 timestamp}&history={bool}&limit={limit}
+// SearchRecords returns the id, version and a highlighted snippet of the versions whose data matches the FTS5 query.
+// Current versions are searched, or those current at the given time, or every version with history=true.
+func SearchRecords(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		err := helpers.WriteError(w, "invalid q; q must be a search query", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	at, err := helpers.ParseTimeParam(r, "at")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid at; at must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	history := false
+	if value := r.URL.Query().Get("history"); value != "" {
+		history, err = strconv.ParseBool(value)
+		if err != nil || (history && !at.IsZero()) {
+			err := helpers.WriteError(w, "invalid history; history must be true or false, and not be combined with at", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+	}
+	if at.IsZero() && !history {
+		at = time.Now()
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limitNumber, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || limitNumber <= 0 || limitNumber > maxSearchLimit {
+			err := helpers.WriteError(w, fmt.Sprintf("invalid limit; limit must be a number from 1 to %v", maxSearchLimit), http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+		limit = int(limitNumber)
+	}
+
+	results, err := a.PersistentRecords().SearchRecords(ctx, query, at, limit)
+	if errors.Is(err, service.ErrSearchUnavailable) {
+		err := helpers.WriteError(w, "full-text search is not available on this server", http.StatusNotImplemented)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrSearchQueryInvalid) {
+		err := helpers.WriteError(w, "invalid q; q is not a valid full-text query", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	err = helpers.WriteJSON(w, results, http.StatusOK)
+	helpers.LogError(err)
+}
@@ -0,0 +1,26 @@
+package v2
+
+import (
+	"net/http"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /snapshot?at={RFC3339 timestamp}
+// Snapshot streams every record as it existed at the given time as newline-delimited JSON.
+func Snapshot(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	at, err := helpers.ParseTimeParam(r, "at")
+	if err != nil || at.IsZero() {
+		err := helpers.WriteError(w, "invalid at; at must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	streamRecords(w, func(yield func(*entity.PersistentRecord) error) error {
+		return a.PersistentRecords().Snapshot(ctx, at, yield)
+	})
+}
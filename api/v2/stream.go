@@ -0,0 +1,65 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
+)
+
+// flushEvery is the number of streamed lines after which the response is flushed to the client.
+const flushEvery = 100
+
+// streamWriteTimeout is the time a stream has to write the next flushEvery lines. The write timeout of the server
+// bounds the whole response, which a long stream outlives, so streams move their deadline forward as they go.
+const streamWriteTimeout = 15 * time.Second
+
+// streamStatusTrailer is the trailer that ends a stream: complete when every line was written, error when reading
+// the records failed. A stream without it was cut off.
+const streamStatusTrailer = "X-Stream-Status"
+
+// streamRecords writes the records passed by stream as newline-delimited JSON, and the status of the stream as a
+// trailer once it has ended.
+func streamRecords(w http.ResponseWriter, stream func(yield func(*entity.PersistentRecord) error) error) {
+	w.Header().Add("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", streamStatusTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+	extendDeadline := func() error {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	err := extendDeadline()
+	if err == nil {
+		written := 0
+		err = stream(func(record *entity.PersistentRecord) error {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+			written++
+			if written%flushEvery == 0 {
+				if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+					return err
+				}
+				return extendDeadline()
+			}
+			return nil
+		})
+	}
+
+	// the status has already been sent, so a failure can only be reported in the trailer
+	status := "complete"
+	if err != nil {
+		status = "error"
+	}
+	w.Header().Set(streamStatusTrailer, status)
+	helpers.LogError(err)
+}
@@ -2,6 +2,9 @@ package v2
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -13,8 +16,21 @@ import (
 )
 
 // POST /records/{id}
+// POST /records/{id}?valid_from={RFC3339 timestamp}&valid_to={RFC3339 timestamp}
+// POST /records/{id}?type={record type}
 // if the record exists, the record is updated with a new version.
 // if the record doesn't exist, the record is created.
+// type sets the record type, whose JSON Schema the new version must match (422 otherwise);
+// later versions keep the type.
+// valid_from/valid_to set the valid time of the new version (defaults: now, open-ended),
+// which allows recording retroactive corrections.
+// an If-Match header with the ETag of a previous response makes the update conditional;
+// it is rejected with 412 if the record has moved to another version since.
+// the X-Change-Author, X-Change-Reason and X-Change-Source headers are stored with the new version.
+// the body is a JSON object of string updates (application/json, also assumed without a Content-Type),
+// an RFC 7396 merge patch of any JSON values (application/merge-patch+json),
+// or a list of RFC 6902 operations (application/json-patch+json) applied all or nothing;
+// a failing operation, such as a test, is rejected with 409, and other media types with 415.
 func UpdateRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id := mux.Vars(r)["id"]
@@ -26,16 +42,131 @@ func UpdateRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var body map[string]*string
-	err = json.NewDecoder(r.Body).Decode(&body)
+	validFrom, err := helpers.ParseTimeParam(r, "valid_from")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid valid_from; valid_from must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	validTo, err := helpers.ParseTimeParam(r, "valid_to")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid valid_to; valid_to must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
 
+	ifMatch, err := helpers.ParseIfMatch(r)
 	if err != nil {
-		err := helpers.WriteError(w, "invalid input; could not parse json", http.StatusBadRequest)
+		err := helpers.WriteError(w, "invalid If-Match; expected * or a list of entity tags", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if ifMatch.NeverHolds() {
+		err := helpers.WriteError(w, ifMatch.Failure(idNumber), http.StatusPreconditionFailed)
 		helpers.LogError(err)
 		return
 	}
 
-	temp, err := a.PersistentRecords().UpdateRecord(ctx, int(idNumber), body)
+	author, reason, source := helpers.ParseChangeHeaders(r)
+	opts := service.UpdateOptions{
+		ValidFrom:        validFrom,
+		ValidTo:          validTo,
+		ExpectedVersions: ifMatch.Versions,
+		MustExist:        ifMatch.Any,
+		RecordType:       r.URL.Query().Get("type"),
+		Author:           author,
+		Reason:           reason,
+		Source:           source,
+	}
+
+	var temp entity.Record
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+	switch mediaType {
+	case "application/json-patch+json":
+		var operations []entity.PatchOperation
+		err = json.NewDecoder(r.Body).Decode(&operations)
+
+		if err != nil {
+			err := helpers.WriteError(w, "invalid input; could not parse json patch", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+
+		temp, err = a.PersistentRecords().PatchRecord(ctx, int(idNumber), operations, opts)
+
+	case "application/merge-patch+json":
+		var patch map[string]json.RawMessage
+		err = json.NewDecoder(r.Body).Decode(&patch)
+
+		if err != nil {
+			err := helpers.WriteError(w, "invalid input; could not parse json merge patch", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+
+		temp, err = a.PersistentRecords().MergeRecord(ctx, int(idNumber), patch, opts)
+
+	case "application/json":
+		var body map[string]*string
+		err = json.NewDecoder(r.Body).Decode(&body)
+
+		if err != nil {
+			err := helpers.WriteError(w, "invalid input; could not parse json", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+
+		temp, err = a.PersistentRecords().UpdateRecord(ctx, int(idNumber), body, opts)
+
+	default:
+		err := helpers.WriteError(w, "unsupported media type; expected application/json, application/merge-patch+json or application/json-patch+json", http.StatusUnsupportedMediaType)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrPatchInvalid) {
+		err := helpers.WriteError(w, fmt.Sprintf("invalid input; %v", err), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrPatchFailed) {
+		err := helpers.WriteError(w, err.Error(), http.StatusConflict)
+		helpers.LogError(err)
+		return
+	}
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		err := helpers.WriteFieldErrors(w, fmt.Sprintf("invalid input; record does not match schema %v version %v", validationErr.RecordType, validationErr.SchemaVersion), validationErr.Fields, http.StatusUnprocessableEntity)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrRecordTypeInvalid) {
+		err := helpers.WriteError(w, "invalid type; type must be lowercase letters, digits and underscores", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrSchemaDoesNotExist) {
+		err := helpers.WriteError(w, "invalid type; no schema is registered for the record type", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrConcurrentUpdate) {
+		err := helpers.WriteError(w, err.Error(), http.StatusConflict)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrVersionConflict) {
+		err := helpers.WriteError(w, ifMatch.Failure(idNumber), http.StatusPreconditionFailed)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrValidityInvalid) {
+		err := helpers.WriteError(w, "invalid validity; valid_to must be after valid_from", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
 	if err != nil {
 		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
 		helpers.LogError(err)
@@ -45,6 +176,7 @@ func UpdateRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
 
 	record := temp.(*entity.PersistentRecord)
 
+	setETag(w, record)
 	err = helpers.WriteJSON(w, record, http.StatusOK)
 	helpers.LogError(err)
 }
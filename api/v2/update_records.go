@@ -0,0 +1,88 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/service"
+)
+
+// maxBatchUpdates is the largest number of updates accepted in one batch.
+const maxBatchUpdates = 100000
+
+// POST /records:batch
+// POST /records:batch?atomic=false
+// UpdateRecords applies a JSON array of {"id", "data", "expected_version", "valid_from", "valid_to", "type",
+// "author", "reason", "source"} updates, each with the semantics of POST /records/{id}.
+// By default the batch is atomic: if any update fails, none is applied and the response is 400.
+// With atomic=false the failing updates are reported and skipped. If the batch stops on an internal error,
+// the response is 500 with the outcome of every update: those committed before stay applied.
+func UpdateRecords(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	atomic := true
+	if value := r.URL.Query().Get("atomic"); value != "" {
+		var err error
+		atomic, err = strconv.ParseBool(value)
+		if err != nil {
+			err := helpers.WriteError(w, "invalid atomic; atomic must be true or false", http.StatusBadRequest)
+			helpers.LogError(err)
+			return
+		}
+	}
+
+	var body []entity.BatchUpdate
+	err := json.NewDecoder(r.Body).Decode(&body)
+
+	if err != nil {
+		err := helpers.WriteError(w, "invalid input; could not parse json", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if len(body) > maxBatchUpdates {
+		err := helpers.WriteError(w, fmt.Sprintf("invalid input; a batch holds at most %v updates", maxBatchUpdates), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	// the X-Change-* headers describe every update that does not name its own author, reason or source
+	author, reason, source := helpers.ParseChangeHeaders(r)
+	for i := range body {
+		if body[i].Author == "" {
+			body[i].Author = author
+		}
+		if body[i].Reason == "" {
+			body[i].Reason = reason
+		}
+		if body[i].Source == "" {
+			body[i].Source = source
+		}
+	}
+
+	result, err := a.PersistentRecords().UpdateRecords(ctx, body, atomic)
+	if err != nil && result == nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+	if err != nil {
+		// the chunks committed before the error stay applied, so the outcome of every update is reported
+		result.Error = helpers.ErrInternal.Error()
+		errInWriting := helpers.WriteJSON(w, result, http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	status := http.StatusOK
+	if atomic && result.Failed > 0 {
+		status = http.StatusBadRequest
+	}
+	err = helpers.WriteJSON(w, result, status)
+	helpers.LogError(err)
+}
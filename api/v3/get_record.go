@@ -0,0 +1,47 @@
+package v3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// GET /records/{id}
+// GetRecord retrieves the latest version of the record, with typed values; 410 Gone if it has been deleted.
+func GetRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		err := helpers.WriteError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	record, err := a.TypedRecords().GetRecord(
+		ctx,
+		int(idNumber),
+	)
+	if errors.Is(err, service.ErrRecordDeleted) {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v has been deleted", idNumber), http.StatusGone)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		err := helpers.WriteError(w, fmt.Sprintf("record of id %v does not exist", idNumber), http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	helpers.SetETag(w, record.GetVersion())
+	err = helpers.WriteJSON(w, record, http.StatusOK)
+	helpers.LogError(err)
+}
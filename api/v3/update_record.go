@@ -0,0 +1,122 @@
+package v3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/regr76/timetravel/api/helpers"
+	"github.com/regr76/timetravel/service"
+)
+
+// POST /records/{id}
+// POST /records/{id}?valid_from={RFC3339 timestamp}&valid_to={RFC3339 timestamp}
+// POST /records/{id}?type={record type}
+// if the record exists, the record is updated with a new version.
+// if the record doesn't exist, the record is created.
+// the body is a JSON object whose values may be any JSON value; each value replaces the
+// value of its key and null deletes the key. type, valid_from/valid_to, If-Match and the
+// X-Change-* headers work as in v2.
+func UpdateRecord(a service.Storage, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+
+	if err != nil || idNumber <= 0 {
+		err := helpers.WriteError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	validFrom, err := helpers.ParseTimeParam(r, "valid_from")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid valid_from; valid_from must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	validTo, err := helpers.ParseTimeParam(r, "valid_to")
+	if err != nil {
+		err := helpers.WriteError(w, "invalid valid_to; valid_to must be an RFC3339 timestamp", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	ifMatch, err := helpers.ParseIfMatch(r)
+	if err != nil {
+		err := helpers.WriteError(w, "invalid If-Match; expected * or a list of entity tags", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if ifMatch.NeverHolds() {
+		err := helpers.WriteError(w, ifMatch.Failure(idNumber), http.StatusPreconditionFailed)
+		helpers.LogError(err)
+		return
+	}
+
+	var body map[string]json.RawMessage
+	err = json.NewDecoder(r.Body).Decode(&body)
+
+	if err != nil {
+		err := helpers.WriteError(w, "invalid input; could not parse json", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+
+	author, reason, source := helpers.ParseChangeHeaders(r)
+	opts := service.UpdateOptions{
+		ValidFrom:        validFrom,
+		ValidTo:          validTo,
+		ExpectedVersions: ifMatch.Versions,
+		MustExist:        ifMatch.Any,
+		RecordType:       r.URL.Query().Get("type"),
+		Author:           author,
+		Reason:           reason,
+		Source:           source,
+	}
+	record, err := a.TypedRecords().UpdateRecord(ctx, int(idNumber), body, opts)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		err := helpers.WriteFieldErrors(w, fmt.Sprintf("invalid input; record does not match schema %v version %v", validationErr.RecordType, validationErr.SchemaVersion), validationErr.Fields, http.StatusUnprocessableEntity)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrRecordTypeInvalid) {
+		err := helpers.WriteError(w, "invalid type; type must be lowercase letters, digits and underscores", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrSchemaDoesNotExist) {
+		err := helpers.WriteError(w, "invalid type; no schema is registered for the record type", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrConcurrentUpdate) {
+		err := helpers.WriteError(w, err.Error(), http.StatusConflict)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrVersionConflict) {
+		err := helpers.WriteError(w, ifMatch.Failure(idNumber), http.StatusPreconditionFailed)
+		helpers.LogError(err)
+		return
+	}
+	if errors.Is(err, service.ErrValidityInvalid) {
+		err := helpers.WriteError(w, "invalid validity; valid_to must be after valid_from", http.StatusBadRequest)
+		helpers.LogError(err)
+		return
+	}
+	if err != nil {
+		errInWriting := helpers.WriteError(w, helpers.ErrInternal.Error(), http.StatusInternalServerError)
+		helpers.LogError(err)
+		helpers.LogError(errInWriting)
+		return
+	}
+
+	helpers.SetETag(w, record.GetVersion())
+	err = helpers.WriteJSON(w, record, http.StatusOK)
+	helpers.LogError(err)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/service"
+	"github.com/regr76/timetravel/storage"
+)
+
+// defaultSigningKeyFile holds the Ed25519 key that signs checkpoints, unless SIGNING_KEY_FILE names another file.
+const defaultSigningKeyFile = "timetravel.key"
+
+// signingKeyFile is the file of the key that signs checkpoints.
+func signingKeyFile() string {
+	if filename := os.Getenv("SIGNING_KEY_FILE"); filename != "" {
+		return filename
+	}
+	return defaultSigningKeyFile
+}
+
+// runCommand runs a maintenance command given on the command line instead of the server.
+func runCommand(ctx context.Context, store storage.Store, command string) error {
+	switch command {
+	case "migrate":
+		// the migrations were applied when the database was opened
+		log.Printf("database schema is up to date")
+		return nil
+	case "verify":
+		return verify(ctx, store)
+	case "checkpoint":
+		return checkpoint(ctx, store, signingKeyFile())
+	default:
+		return fmt.Errorf("unknown command %q; the commands are: migrate, verify, checkpoint, keygen", command)
+	}
+}
+
+// verify checks the hash chain of every record in the database and logs each record whose history has been
+// edited since it was written. It fails if there is any.
+func verify(ctx context.Context, store storage.Store) error {
+	s := service.NewPersistentRecordService(store)
+
+	records, broken := 0, 0
+	err := s.VerifyRecords(ctx, func(verification *entity.Verification) error {
+		records++
+		if !verification.Valid {
+			broken++
+			log.Printf("record %d: %s", verification.ID, verification.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("verified %d records, %d failed", records, broken)
+	if broken > 0 {
+		return fmt.Errorf("%d of %d records failed verification", broken, records)
+	}
+	return nil
+}
+
+// checkpoint signs the Merkle root of every day before today that has versions but no checkpoint yet.
+// It is meant to run once a day, shortly after midnight UTC.
+func checkpoint(ctx context.Context, store storage.Store, keyFile string) error {
+	key, err := service.LoadSigningKey(keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w; create the signing key with tt keygen, or set SIGNING_KEY_FILE to the key in use", err)
+	}
+	if err != nil {
+		return err
+	}
+	s := service.NewPersistentRecordService(store)
+
+	checkpoints, err := s.CreateCheckpoints(ctx, key, time.Now())
+	for _, checkpoint := range checkpoints {
+		log.Printf("checkpointed %s: %d versions, root %s", checkpoint.Day, checkpoint.Leaves, checkpoint.Root)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("created %d checkpoints", len(checkpoints))
+	return nil
+}
+
+// keygen creates the key that signs checkpoints and prints its public key, which is to be published apart from
+// the database so that auditors can tell the checkpoints were signed with it. It fails if the key exists.
+func keygen(keyFile string) error {
+	key, err := service.CreateSigningKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("created signing key %s; publish its public key:", keyFile)
+	fmt.Println(hex.EncodeToString(key.Public().(ed25519.PublicKey)))
+	return nil
+}
@@ -0,0 +1,85 @@
+package dbutils
+
+import (
+	"github.com/regr76/timetravel/storage"
+)
+
+const (
+	checkpointsTableName = "checkpoints"
+	// a checkpoint is the signed Merkle root over the versions that started on a day (UTC, YYYYMMDD),
+	// with the public key that verifies the signature.
+	checkpointColumns = `day, leaves, root, created, signature, public_key`
+)
+
+// ErrCheckpointExists is returned by WriteCheckpoint when the day already has a checkpoint.
+var ErrCheckpointExists = storage.ErrCheckpointExists
+
+// CheckpointRow is the stored checkpoint of a day. Root, Signature and PublicKey are hex encoded.
+type CheckpointRow = storage.CheckpointRow
+
+func scanCheckpointRow(scanner rowScanner) (*CheckpointRow, error) {
+	var row CheckpointRow
+	err := scanner.Scan(&row.Day, &row.Leaves, &row.Root, &row.Created, &row.Signature, &row.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func ReadCheckpoint(db Querier, day string) (*CheckpointRow, error) {
+	query := `SELECT ` + checkpointColumns + ` FROM ` + checkpointsTableName + ` WHERE day = ?`
+	return scanCheckpointRow(db.QueryRow(query, day))
+}
+
+// WriteCheckpoint stores the checkpoint of a day; a checkpoint is never replaced.
+func WriteCheckpoint(db Querier, row CheckpointRow) error {
+	query := `INSERT INTO ` + checkpointsTableName + ` (` + checkpointColumns + `) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (day) DO NOTHING`
+	result, err := db.Exec(query, row.Day, row.Leaves, row.Root, row.Created, row.Signature, row.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrCheckpointExists
+	}
+	return nil
+}
+
+// ReadDaysWithoutCheckpoint reads, in ascending order, the days before the given day on which versions
+// started that have no checkpoint yet.
+func ReadDaysWithoutCheckpoint(db Querier, before string) ([]string, error) {
+	query := `SELECT DISTINCT substr(start, 1, 8) AS day FROM ` + tableName + ` WHERE start < ?
+		AND substr(start, 1, 8) NOT IN (SELECT day FROM ` + checkpointsTableName + `) ORDER BY day ASC`
+	rows, err := db.Query(query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var days []string
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// ReadDayVersions reads the versions that started on the day, in the order they are leaves of its
+// Merkle tree: by start, then id and version.
+func ReadDayVersions(db Querier, day string) ([]Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE substr(start, 1, 8) = ? ORDER BY start ASC, id ASC, version ASC`
+	rows, err := db.Query(query, day)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows)
+}
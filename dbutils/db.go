@@ -1,32 +1,81 @@
 package dbutils
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"fmt"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/regr76/timetravel/storage"
 )
 
 const (
-	tableName        = "records"
-	createTableQuery = `
-	CREATE TABLE IF NOT EXISTS ` + tableName + ` (
-		id INTEGER NOT NULL,
-		version INTEGER NOT NULL DEFAULT 1,
-		start TEXT NOT NULL,
-		end TEXT,
-		data TEXT NOT NULL DEFAULT '{}',
-		PRIMARY KEY (id, version),
-
-		-- Ensure metadata always contains valid JSON
-		CHECK (json_valid(data))
-	) STRICT;
-	`
+	tableName = "records"
+	// start/end hold the transaction time (when a version was recorded and superseded),
+	// valid_from/valid_to hold the valid time supplied by the caller.
+	// record_type/schema_version name the schema the data was validated against, if any.
+	// deleted marks a tombstone, the version that closes a deleted record.
+	// author/reason/source describe who made the change, why, and from which system.
+	// hash chains the version to the previous version of the record, see storage.HashVersion.
+	columns = `id, version, start, end, valid_from, valid_to, data, record_type, schema_version, deleted, author, reason, source, hash`
+
+	schemasTableName = "schemas"
+	schemaColumns    = `record_type, version, created, schema`
 )
 
+// plainKeyPattern matches data keys that can be written as a JSON path literal without quoting.
+var plainKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ErrVersionConflict is returned by WriteNextVersion when the record no longer is at the preceding version.
+var ErrVersionConflict = storage.ErrVersionConflict
+
+// Querier is implemented by both *sql.DB and *sql.Tx, so the read and write functions
+// below can be composed into a single transaction with WithTx.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sqliteMigrations bring a SQLite database up to the schema of this build. The migrations up to the hash
+// chain were written before the schema had versions and check whether their change is already there, so a
+// database from then starts at the first one like a new database does.
+var sqliteMigrations = migrations{
+	steps: loadMigrations("sqlite",
+		migration{version: 2, name: "valid_time", up: migrateValidTime},
+		migration{version: 4, name: "record_types", up: migrateRecordTypes},
+		migration{version: 6, name: "deletions", up: migrateDeletions},
+		migration{version: 7, name: "change_metadata", up: migrateChangeMetadata},
+		migration{version: 8, name: "hash_chain", up: migrateHashChain},
+		migration{version: 11, name: "hash_all_columns", up: migrateHashAllColumns(
+			`SELECT `+columns+` FROM `+tableName+` ORDER BY id ASC, version ASC`,
+			`UPDATE `+tableName+` SET hash = ? WHERE id = ? AND version = ?`)},
+		migration{version: 12, name: "data_key_text_indexes", up: createDataKeyIndexes(dataKeyExpression)},
+	),
+	record: `INSERT INTO ` + migrationsTableName + ` (version, name, applied) VALUES (?, ?, ?)`,
+}
+
+// InitDB opens the SQLite database in the file, creating it if needed, and applies the migrations it has
+// not had yet. It fails if the database is newer than this build.
 func InitDB(filename string) (*sql.DB, error) {
+	return openSQLite(filename, sqliteMigrations.migrate)
+}
+
+// OpenDB opens the SQLite database in the file without changing its schema. It fails with ErrSchemaOutdated
+// if the database has migrations to apply, and with ErrSchemaTooNew if it is newer than this build.
+func OpenDB(filename string) (*sql.DB, error) {
+	return openSQLite(filename, sqliteMigrations.check)
+}
+
+func openSQLite(filename string, prepare func(ctx context.Context, db *sql.DB) error) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", "file:"+filename+"?_journal_mode=WAL&_busy_timeout=1000")
 	if err != nil {
 		return nil, err
@@ -41,95 +90,235 @@ func InitDB(filename string) (*sql.DB, error) {
 		log.Fatal(err)
 	}
 
-	_, err = db.Exec(createTableQuery)
+	err = prepare(context.Background(), db)
+	if err == nil {
+		// whether there is a full-text index depends on the build rather than on the schema,
+		// so it is checked every time the database is opened
+		err = initSearch(db)
+	}
 	if err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func ReadOneVersion(db *sql.DB, id int, version int) (string, error) {
-	var idx, ver, start, end, data string
-	query := `SELECT * FROM ` + tableName + ` WHERE id = ? AND version = ?`
-	err := db.QueryRow(query, id, version).Scan(&idx, &ver, &start, &end, &data)
+// migrateValidTime adds the valid time columns to databases created before records were bitemporal.
+// Existing versions are considered valid from the moment they were recorded.
+func migrateValidTime(tx Querier) error {
+	added, err := addColumn(tx, "valid_from", `TEXT NOT NULL DEFAULT ''`)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if added {
+		_, err = tx.Exec(`UPDATE ` + tableName + ` SET valid_from = start WHERE valid_from = ''`)
+		if err != nil {
+			return err
+		}
 	}
 
-	result := fmt.Sprintf("{\"id\": %s,\"version\": %s, \"start\": \"%s\", \"end\": \"%s\", \"data\": %s}", idx, ver, start, end, data)
-	return result, nil
+	_, err = addColumn(tx, "valid_to", `TEXT NOT NULL DEFAULT ''`)
+	return err
 }
 
-func ReadAllVersions(db *sql.DB, id int) ([]string, error) {
-	query := `SELECT * FROM ` + tableName + ` WHERE id = ? ORDER BY version ASC`
-	rows, err := db.Query(query, id)
+// migrateRecordTypes adds the schema columns to databases created before records had types.
+// Existing versions have no type and were not validated.
+func migrateRecordTypes(tx Querier) error {
+	_, err := addColumn(tx, "record_type", `TEXT NOT NULL DEFAULT ''`)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func() {
-		_ = rows.Close()
-	}()
 
-	var versions []string
-	for rows.Next() {
-		// scan into all five columns
-		var idx, ver, start, end, data string
-		if err := rows.Scan(&idx, &ver, &start, &end, &data); err != nil {
-			return nil, err
+	_, err = addColumn(tx, "schema_version", `INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+// migrateDeletions adds the column marking tombstones to databases created before records could be deleted.
+func migrateDeletions(tx Querier) error {
+	_, err := addColumn(tx, "deleted", `INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+// migrateChangeMetadata adds the change metadata columns to databases created before changes were attributed.
+// Existing versions have no author, reason or source.
+func migrateChangeMetadata(tx Querier) error {
+	for _, column := range []string{"author", "reason", "source"} {
+		_, err := addColumn(tx, column, `TEXT NOT NULL DEFAULT ''`)
+		if err != nil {
+			return err
 		}
-		result := fmt.Sprintf("{\"id\": %s,\"version\": %s, \"start\": \"%s\", \"end\": \"%s\", \"data\": %s}", idx, ver, start, end, data)
-		versions = append(versions, result)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return nil
+}
+
+// migrateHashChain adds the hash column to databases created before versions were chained,
+// and computes the chain of the existing history.
+func migrateHashChain(tx Querier) error {
+	added, err := addColumn(tx, "hash", `TEXT NOT NULL DEFAULT ''`)
+	if err != nil || !added {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT ` + columns + ` FROM ` + tableName + ` ORDER BY id ASC, version ASC`)
+	if err != nil {
+		return err
+	}
+	versions, err := scanRows(rows)
+	if err != nil {
+		return err
+	}
+
+	previous := Row{}
+	for _, row := range versions {
+		previousHash := ""
+		if previous.ID == row.ID && previous.Version == row.Version-1 {
+			previousHash = previous.Hash
+		}
+		row.Hash = storage.HashVersion(row, previousHash)
+		if _, err := tx.Exec(`UPDATE `+tableName+` SET hash = ? WHERE id = ? AND version = ?`, row.Hash, row.ID, row.Version); err != nil {
+			return err
+		}
+		previous = row
 	}
+	return nil
+}
 
-	return versions, nil
+// legacyHashVersion is the hash of a version as it was computed before the hash covered the valid time, the
+// type and the change metadata of the version.
+func legacyHashVersion(row Row, previousHash string) string {
+	encoded, _ := json.Marshal([]any{row.ID, row.Version, row.Start, row.End, string(row.Data), previousHash})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
 }
 
-func ReadLatestVersion(db *sql.DB, id int) (string, error) {
-	var idx, ver, start, end, data string
-	query := `SELECT * FROM ` + tableName + ` WHERE id = ? ORDER BY version DESC LIMIT 1`
-	err := db.QueryRow(query, id).Scan(&idx, &ver, &start, &end, &data)
+// migrateHashAllColumns computes again, with every column, the hashes that were computed with only some
+// of them. Only the versions that still match their old hash are given a new one: the chain of a record
+// is left as it is from the first version that does not, so verification keeps reporting the edit.
+// The queries read all versions in id and version order and set the hash of a version.
+func migrateHashAllColumns(selectQuery string, updateQuery string) func(tx Querier) error {
+	return func(tx Querier) error {
+		rows, err := tx.Query(selectQuery)
+		if err != nil {
+			return err
+		}
+		versions, err := scanRows(rows)
+		if err != nil {
+			return err
+		}
+
+		previous, previousHash, intact := Row{ID: -1}, "", false
+		for _, row := range versions {
+			oldPreviousHash := ""
+			switch {
+			case previous.ID != row.ID:
+				previousHash, intact = "", true
+			case previous.Version == row.Version-1:
+				oldPreviousHash = previous.Hash
+			default:
+				intact = false
+			}
+			previous = row
+			if !intact || row.Hash != legacyHashVersion(row, oldPreviousHash) {
+				intact = false
+				continue
+			}
+
+			previousHash = storage.HashVersion(row, previousHash)
+			if _, err := tx.Exec(updateQuery, previousHash, row.ID, row.Version); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumn adds a column to the records table unless it already exists.
+func addColumn(tx Querier, name string, definition string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM pragma_table_info('` + tableName + `') WHERE name = ?`
+	err := tx.QueryRow(query, name).Scan(&count)
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE ` + tableName + ` ADD COLUMN ` + name + ` ` + definition)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WithTx runs fn inside a transaction, which is committed if fn succeeds and rolled back otherwise.
+// fn must only use the Querier it is given; the database allows a single open connection.
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx Querier) error) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	result := fmt.Sprintf("{\"id\": %s,\"version\": %s, \"start\": \"%s\", \"end\": \"%s\", \"data\": %s}", idx, ver, start, end, data)
-	return result, nil
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			log.Printf("tx rollback: %v", rerr)
+		}
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func WriteVersion(db *sql.DB, id int, version int, start string, end string, data string) error {
-	query := `INSERT INTO ` + tableName + ` (id, version, start, end, data) VALUES (?, ?, ?, ?, ?)`
-	_, err := db.Exec(query, id, version, start, end, data)
+// WithSavepoint runs fn inside a savepoint of an open transaction. If fn fails, only its writes are
+// rolled back and the transaction stays usable for further statements.
+func WithSavepoint(tx Querier, fn func() error) error {
+	if _, err := tx.Exec(`SAVEPOINT item`); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		if _, rerr := tx.Exec(`ROLLBACK TO item`); rerr != nil {
+			return rerr
+		}
+		if _, rerr := tx.Exec(`RELEASE item`); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+
+	_, err := tx.Exec(`RELEASE item`)
 	return err
 }
 
-func UpdateVersion(db *sql.DB, id int, version int, end string) error {
-	query := `UPDATE ` + tableName + ` SET end = ? WHERE id = ? AND version = ?`
-	_, err := db.Exec(query, end, id, version)
-	return err
+// Row is one stored version of a record. Data holds the JSON object stored in the data column.
+type Row = storage.Row
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func ReadAllRows(db *sql.DB) ([]string, error) {
-	query := `SELECT * FROM ` + tableName
-	rows, err := db.Query(query)
+// scanRow scans the columns selected by the columns constant into a Row.
+func scanRow(scanner rowScanner) (*Row, error) {
+	var row Row
+	err := scanner.Scan(&row.ID, &row.Version, &row.Start, &row.End, &row.ValidFrom, &row.ValidTo, &row.Data, &row.RecordType, &row.SchemaVersion, &row.Deleted, &row.Author, &row.Reason, &row.Source, &row.Hash)
 	if err != nil {
 		return nil, err
 	}
+	return &row, nil
+}
+
+// scanRows scans all rows of a query into Rows and closes them.
+func scanRows(rows *sql.Rows) ([]Row, error) {
 	defer func() {
 		_ = rows.Close()
 	}()
 
-	var results []string
+	var results []Row
 	for rows.Next() {
-		var id, version int
-		var start, end, data string
-		if err := rows.Scan(&id, &version, &start, &end, &data); err != nil {
+		row, err := scanRow(rows)
+		if err != nil {
 			return nil, err
 		}
-		results = append(results, data)
+		results = append(results, *row)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -137,3 +326,259 @@ func ReadAllRows(db *sql.DB) ([]string, error) {
 
 	return results, nil
 }
+
+func ReadOneVersion(db Querier, id int, version int) (*Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE id = ? AND version = ?`
+	return scanRow(db.QueryRow(query, id, version))
+}
+
+func ReadAllVersions(db Querier, id int) ([]Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE id = ? ORDER BY version ASC`
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows)
+}
+
+// ReadVersionRange reads the versions from fromVersion to toVersion (both inclusive) of a record in ascending
+// order; a toVersion of 0 reads up to the latest version.
+func ReadVersionRange(db Querier, id int, fromVersion int, toVersion int) ([]Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE id = ? AND version >= ?`
+	args := []any{id, fromVersion}
+	if toVersion > 0 {
+		query += ` AND version <= ?`
+		args = append(args, toVersion)
+	}
+	query += ` ORDER BY version ASC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows)
+}
+
+func ReadLatestVersion(db Querier, id int) (*Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE id = ? ORDER BY version DESC LIMIT 1`
+	return scanRow(db.QueryRow(query, id))
+}
+
+func ReadVersionAt(db Querier, id int, at string) (*Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE id = ? AND start <= ? AND (end = '' OR end > ?) ORDER BY version DESC LIMIT 1`
+	return scanRow(db.QueryRow(query, id, at, at))
+}
+
+func ReadVersionAsOf(db Querier, id int, knownAt string, validAt string) (*Row, error) {
+	// the most recently recorded version (as known at knownAt) whose validity covers validAt wins
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE id = ? AND start <= ? AND valid_from <= ? AND (valid_to = '' OR valid_to > ?) ORDER BY version DESC LIMIT 1`
+	return scanRow(db.QueryRow(query, id, knownAt, validAt, validAt))
+}
+
+// DataFilter matches versions whose data has the value at the key.
+type DataFilter = storage.DataFilter
+
+// ErrDataKeyInvalid is returned for a data key that cannot be expressed as a JSON path.
+var ErrDataKeyInvalid = storage.ErrDataKeyInvalid
+
+// indexedDataKeys are the data keys records are most often searched by. Each has an index on the
+// expression that compares its values, in SQLite and in PostgreSQL.
+var indexedDataKeys = []string{"state", "industry"}
+
+// createDataKeyIndexes returns a migration that (re)creates the index of every key of indexedDataKeys
+// on the expression of the key. It replaces the indexes the data_key_indexes migrations created on the
+// plain extracted value, which queries no longer use since non-string values are compared as JSON text.
+func createDataKeyIndexes(expression func(key string) string) func(tx Querier) error {
+	return func(tx Querier) error {
+		for _, key := range indexedDataKeys {
+			index := tableName + "_data_" + key
+			if _, err := tx.Exec(`DROP INDEX IF EXISTS ` + index); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`CREATE INDEX ` + index + ` ON ` + tableName + ` ((` + expression(key) + `))`); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// dataKeyExpression is the SQL expression of the value of a data key as v2 shows it: strings as they are,
+// other values as their JSON text. Plain keys are written as literals so that the expression matches the
+// one of an index on the key; other keys take their JSON path as a parameter, once per placeholder.
+func dataKeyExpression(key string) string {
+	path := `?`
+	if plainKeyPattern.MatchString(key) {
+		path = `'$.` + key + `'`
+	}
+	return `CASE json_type(data, ` + path + `) WHEN 'text' THEN json_extract(data, ` + path + `) ELSE data -> ` + path + ` END`
+}
+
+// ReadVersionsWhere reads a page of at most limit versions that were current at the given time and match
+// every filter, one per record, for records with an id greater than afterID in ascending id order.
+// Records that were deleted at that time are left out.
+func ReadVersionsWhere(db Querier, at string, filters []DataFilter, afterID int, limit int) ([]Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE id > ? AND start <= ? AND (end = '' OR end > ?) AND deleted = 0`
+	args := []any{afterID, at, at}
+	for _, filter := range filters {
+		if filter.Key == "" || strings.Contains(filter.Key, `"`) {
+			return nil, ErrDataKeyInvalid
+		}
+		query += ` AND ` + dataKeyExpression(filter.Key) + ` = ?`
+		if !plainKeyPattern.MatchString(filter.Key) {
+			path := `$."` + filter.Key + `"`
+			args = append(args, path, path, path)
+		}
+		args = append(args, filter.Value)
+	}
+	query += ` ORDER BY id ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows)
+}
+
+// WriteVersion inserts the version, chained to the stored previous version of the record.
+func WriteVersion(db Querier, row Row) error {
+	previousHash, err := readPreviousHash(db, row)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO ` + tableName + ` (` + columns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(query, row.ID, row.Version, row.Start, row.End, row.ValidFrom, row.ValidTo, string(row.Data), row.RecordType, row.SchemaVersion, row.Deleted, row.Author, row.Reason, row.Source, storage.HashVersion(row, previousHash))
+	return err
+}
+
+// WriteNextVersion inserts the version only if the latest stored version of the record is version-1
+// (or the record does not exist yet for version 1), so concurrent writers cannot both append the same version.
+func WriteNextVersion(db Querier, row Row) error {
+	previousHash, err := readPreviousHash(db, row)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO ` + tableName + ` (` + columns + `) SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE COALESCE((SELECT MAX(version) FROM ` + tableName + ` WHERE id = ?), 0) = ?`
+	result, err := db.Exec(query, row.ID, row.Version, row.Start, row.End, row.ValidFrom, row.ValidTo, string(row.Data), row.RecordType, row.SchemaVersion, row.Deleted, row.Author, row.Reason, row.Source, storage.HashVersion(row, previousHash), row.ID, row.Version-1)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// UpdateVersion closes the version at end. As its hash covers end, the hash is computed again;
+// only the latest version of a record is closed, so no later version depends on the old hash.
+// A version edited since its hash was computed is left as it is, with storage.ErrHashMismatch.
+func UpdateVersion(db Querier, id int, version int, end string) error {
+	row, err := ReadOneVersion(db, id, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	previousHash, err := readPreviousHash(db, *row)
+	if err != nil {
+		return err
+	}
+	if row.Hash != storage.HashVersion(*row, previousHash) {
+		return storage.ErrHashMismatch
+	}
+	row.End = end
+
+	query := `UPDATE ` + tableName + ` SET end = ?, hash = ? WHERE id = ? AND version = ?`
+	_, err = db.Exec(query, end, storage.HashVersion(*row, previousHash), id, version)
+	return err
+}
+
+// readPreviousHash reads the hash of the version preceding the row; the first version has none.
+func readPreviousHash(db Querier, row Row) (string, error) {
+	if row.Version <= 1 {
+		return "", nil
+	}
+	var hash string
+	err := db.QueryRow(`SELECT hash FROM `+tableName+` WHERE id = ? AND version = ?`, row.ID, row.Version-1).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// RowFilter restricts the rows read by ReadRowsPage; zero values do not filter.
+type RowFilter = storage.RowFilter
+
+// ReadRowsPage reads a page of at most limit versions matching the filter that come after the
+// (afterID, afterVersion) cursor, in ascending (id, version) order.
+func ReadRowsPage(db Querier, filter RowFilter, afterID int, afterVersion int, limit int) ([]Row, error) {
+	query := `SELECT ` + columns + ` FROM ` + tableName + ` WHERE (id, version) > (?, ?)`
+	args := []any{afterID, afterVersion}
+	if filter.FromID > 0 {
+		query += ` AND id >= ?`
+		args = append(args, filter.FromID)
+	}
+	if filter.ToID > 0 {
+		query += ` AND id <= ?`
+		args = append(args, filter.ToID)
+	}
+	if filter.Since != "" {
+		query += ` AND (end = '' OR end > ?)`
+		args = append(args, filter.Since)
+	}
+	if filter.Until != "" {
+		query += ` AND start < ?`
+		args = append(args, filter.Until)
+	}
+	query += ` ORDER BY id ASC, version ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows)
+}
+
+// SchemaRow is one stored version of the JSON Schema of a record type.
+type SchemaRow = storage.SchemaRow
+
+func scanSchemaRow(scanner rowScanner) (*SchemaRow, error) {
+	var row SchemaRow
+	err := scanner.Scan(&row.RecordType, &row.Version, &row.Created, &row.Schema)
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func ReadSchema(db Querier, recordType string, version int) (*SchemaRow, error) {
+	query := `SELECT ` + schemaColumns + ` FROM ` + schemasTableName + ` WHERE record_type = ? AND version = ?`
+	return scanSchemaRow(db.QueryRow(query, recordType, version))
+}
+
+func ReadLatestSchema(db Querier, recordType string) (*SchemaRow, error) {
+	query := `SELECT ` + schemaColumns + ` FROM ` + schemasTableName + ` WHERE record_type = ? ORDER BY version DESC LIMIT 1`
+	return scanSchemaRow(db.QueryRow(query, recordType))
+}
+
+// WriteNextSchema stores a schema as the next version of the record type and returns that version.
+// Earlier versions are kept, so versions of records stay tied to the schema they were validated against.
+func WriteNextSchema(db Querier, recordType string, created string, schema []byte) (int, error) {
+	query := `INSERT INTO ` + schemasTableName + ` (` + schemaColumns + `)
+		SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ? FROM ` + schemasTableName + ` WHERE record_type = ?
+		RETURNING version`
+	var version int
+	err := db.QueryRow(query, recordType, created, string(schema), recordType).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,290 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/regr76/timetravel/storage"
+)
+
+var errInjected = errors.New("injected failure")
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+// failingQuerier fails the n-th Exec, simulating a crash between the steps of a transaction.
+type failingQuerier struct {
+	Querier
+	failOn int
+	calls  int
+}
+
+func (f *failingQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	f.calls++
+	if f.calls == f.failOn {
+		return nil, errInjected
+	}
+	return f.Querier.Exec(query, args...)
+}
+
+func Test_WithTx_NoHalfWrittenHistory(t *testing.T) {
+	tests := []struct {
+		description string
+		failOn      int  // Exec call that fails; 0 never fails
+		failAfter   bool // fail after all steps, right before the commit
+	}{
+		{
+			description: "Failure while closing the previous version",
+			failOn:      1,
+		},
+		{
+			description: "Failure while inserting the new version",
+			failOn:      2,
+		},
+		{
+			description: "Failure after all steps before commit",
+			failAfter:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			db := newTestDB(t)
+			require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"a":"1"}`)}))
+
+			err := WithTx(context.Background(), db, func(tx Querier) error {
+				q := &failingQuerier{Querier: tx, failOn: tc.failOn}
+
+				// the same read-close-insert sequence the services compose
+				if _, err := ReadLatestVersion(q, 1); err != nil {
+					return err
+				}
+				if err := UpdateVersion(q, 1, 1, "20260102000000000000000"); err != nil {
+					return err
+				}
+				if err := WriteVersion(q, Row{ID: 1, Version: 2, Start: "20260102000000000000000", ValidFrom: "20260102000000000000000", Data: []byte(`{"a":"2"}`)}); err != nil {
+					return err
+				}
+				if tc.failAfter {
+					return errInjected
+				}
+				return nil
+			})
+			require.ErrorIs(t, err, errInjected)
+
+			first := Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"a":"1"}`)}
+			first.Hash = storage.HashVersion(first, "")
+
+			versions, err := ReadAllVersions(db, 1)
+			require.NoError(t, err)
+			require.Equal(t, []Row{first}, versions)
+		})
+	}
+}
+
+func Test_WithTx_Commit(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"a":"1"}`)}))
+
+	err := WithTx(context.Background(), db, func(tx Querier) error {
+		if err := UpdateVersion(tx, 1, 1, "20260102000000000000000"); err != nil {
+			return err
+		}
+		return WriteVersion(tx, Row{ID: 1, Version: 2, Start: "20260102000000000000000", ValidFrom: "20260102000000000000000", Data: []byte(`{"a":"2"}`)})
+	})
+	require.NoError(t, err)
+
+	// closing version 1 hashes it again with its end, and version 2 is chained to that hash
+	first := Row{ID: 1, Version: 1, Start: "20260101000000000000000", End: "20260102000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"a":"1"}`)}
+	first.Hash = storage.HashVersion(first, "")
+	second := Row{ID: 1, Version: 2, Start: "20260102000000000000000", ValidFrom: "20260102000000000000000", Data: []byte(`{"a":"2"}`)}
+	second.Hash = storage.HashVersion(second, first.Hash)
+
+	versions, err := ReadAllVersions(db, 1)
+	require.NoError(t, err)
+	require.Equal(t, []Row{first, second}, versions)
+}
+
+func Test_WriteNextVersion_Conflict(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, WriteNextVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{}`)}))
+	require.NoError(t, WriteNextVersion(db, Row{ID: 1, Version: 2, Start: "20260102000000000000000", ValidFrom: "20260102000000000000000", Data: []byte(`{}`)}))
+
+	// a second writer that also read version 1 must not append another version 2 or skip to 4
+	require.ErrorIs(t, WriteNextVersion(db, Row{ID: 1, Version: 2, Start: "20260103000000000000000", ValidFrom: "20260103000000000000000", Data: []byte(`{}`)}), ErrVersionConflict)
+	require.ErrorIs(t, WriteNextVersion(db, Row{ID: 1, Version: 4, Start: "20260103000000000000000", ValidFrom: "20260103000000000000000", Data: []byte(`{}`)}), ErrVersionConflict)
+	require.ErrorIs(t, WriteNextVersion(db, Row{ID: 2, Version: 2, Start: "20260103000000000000000", ValidFrom: "20260103000000000000000", Data: []byte(`{}`)}), ErrVersionConflict)
+}
+
+func Test_WithSavepoint_RollsBackOnlyFailedItem(t *testing.T) {
+	db := newTestDB(t)
+
+	err := WithTx(context.Background(), db, func(tx Querier) error {
+		if err := WithSavepoint(tx, func() error {
+			return WriteVersion(tx, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{}`)})
+		}); err != nil {
+			return err
+		}
+
+		err := WithSavepoint(tx, func() error {
+			if err := WriteVersion(tx, Row{ID: 2, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{}`)}); err != nil {
+				return err
+			}
+			return errInjected
+		})
+		require.ErrorIs(t, err, errInjected)
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = ReadLatestVersion(db, 1)
+	require.NoError(t, err)
+	_, err = ReadLatestVersion(db, 2)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func Test_ReadVersionsWhere_UsesKeyIndex(t *testing.T) {
+	db := newTestDB(t)
+
+	filters := []DataFilter{{Key: "state", Value: "CA"}}
+	query := `EXPLAIN QUERY PLAN SELECT id FROM ` + tableName + ` WHERE ` + dataKeyExpression(filters[0].Key) + ` = ?`
+	rows, err := db.Query(query, filters[0].Value)
+	require.NoError(t, err)
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		require.NoError(t, rows.Scan(&id, &parent, &unused, &detail))
+		plan = append(plan, detail)
+	}
+	require.NoError(t, rows.Err())
+	require.Contains(t, plan, "SEARCH "+tableName+" USING INDEX "+tableName+"_data_state (<expr>=?)")
+}
+
+func Test_ReadVersionsWhere(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"state":"CA","a.b":"1"}`)}))
+	require.NoError(t, WriteVersion(db, Row{ID: 2, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"state":"CA","a.b":"2"}`)}))
+
+	rows, err := ReadVersionsWhere(db, "20260102000000000000000", []DataFilter{{Key: "state", Value: "CA"}, {Key: "a.b", Value: "2"}}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, 2, rows[0].ID)
+
+	_, err = ReadVersionsWhere(db, "20260102000000000000000", []DataFilter{{Key: `a"b`, Value: "2"}}, 0, 10)
+	require.ErrorIs(t, err, ErrDataKeyInvalid)
+}
+
+func Test_InitSearch_RebuildsMissedWrites(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
+	db, err := InitDB(filename)
+	require.NoError(t, err)
+	if available, err := SearchAvailable(db); err != nil || !available {
+		_ = db.Close()
+		t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+	}
+	require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"notes":"roofing contractor"}`)}))
+
+	// a build without FTS5 drops the triggers and writes without indexing
+	_, err = db.Exec(dropTriggersQuery)
+	require.NoError(t, err)
+	require.NoError(t, WriteVersion(db, Row{ID: 2, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"notes":"roofing supplies","nested":{"employees":12}}`)}))
+	require.NoError(t, db.Close())
+
+	db, err = InitDB(filename)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	hits, err := SearchVersions(db, "roofing", "", 10)
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	hits, err = SearchVersions(db, "12", "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []SearchHit{{ID: 2, Version: 1, Snippet: "roofing supplies <mark>12</mark>"}}, hits)
+}
+
+func Test_SearchVersions_EscapesSnippets(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	if available, err := SearchAvailable(db); err != nil || !available {
+		t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+	}
+	require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000",
+		Data: []byte(`{"notes":"<script>alert(1)</script> roofing & \u0002tiles\u0003"}`)}))
+
+	// only the matches are marked, whatever characters the data holds
+	hits, err := SearchVersions(db, "roofing", "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []SearchHit{{ID: 1, Version: 1, Snippet: "&lt;script&gt;alert(1)&lt;/script&gt; <mark>roofing</mark> &amp;  tiles "}}, hits)
+
+	// an earlier build indexed the text as it is; its index is rebuilt when the database is opened again
+	require.NoError(t, db.Close())
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
+	db, err = InitDB(filename)
+	require.NoError(t, err)
+	_, err = db.Exec(dropTriggersQuery + `
+	CREATE TRIGGER ` + insertTriggerName + ` AFTER INSERT ON ` + tableName + ` WHEN NEW.deleted = 0 BEGIN
+		INSERT INTO ` + searchTableName + ` (id, version, text) VALUES (NEW.id, NEW.version,
+			(SELECT COALESCE(group_concat(atom, ' '), '') FROM json_tree(NEW.data) WHERE type IN ('text', 'integer', 'real')));
+	END;`)
+	require.NoError(t, err)
+	require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000",
+		Data: []byte(`{"notes":"roofing \u0002tiles\u0003"}`)}))
+	require.NoError(t, db.Close())
+
+	db, err = InitDB(filename)
+	require.NoError(t, err)
+	hits, err = SearchVersions(db, "roofing", "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []SearchHit{{ID: 1, Version: 1, Snippet: "<mark>roofing</mark>  tiles "}}, hits)
+}
+
+func Test_InitDB_ChainsExistingHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
+	db, err := InitDB(filename)
+	require.NoError(t, err)
+	require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 1, Start: "20260101000000000000000", End: "20260102000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"a":"1"}`)}))
+	require.NoError(t, WriteVersion(db, Row{ID: 1, Version: 2, Start: "20260102000000000000000", ValidFrom: "20260102000000000000000", Data: []byte(`{"a":"2"}`)}))
+	require.NoError(t, WriteVersion(db, Row{ID: 2, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{}`)}))
+
+	// a database from before versions were chained, and before the schema had versions
+	_, err = db.Exec(`ALTER TABLE ` + tableName + ` DROP COLUMN hash; DROP TABLE ` + migrationsTableName)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = InitDB(filename)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	for _, id := range []int{1, 2} {
+		versions, err := ReadAllVersions(db, id)
+		require.NoError(t, err)
+		previousHash := ""
+		for _, row := range versions {
+			require.Equal(t, storage.HashVersion(row, previousHash), row.Hash)
+			previousHash = row.Hash
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	migrationsTableName        = "schema_migrations"
+	createMigrationsTableQuery = `
+	CREATE TABLE IF NOT EXISTS ` + migrationsTableName + ` (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied TEXT NOT NULL
+	);
+	`
+)
+
+// migrationFiles holds the SQL migrations of each database, named <version>_<name>.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer build, whose schema this build
+// may not read or write correctly.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// ErrSchemaOutdated is returned by OpenDB and OpenPostgres when the database has migrations left to apply.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// migration is one step of the schema. Migrations only go forward: a database is upgraded by applying,
+// in order, the ones it has not had yet, and none is ever undone.
+type migration struct {
+	version int
+	name    string
+	up      func(tx Querier) error
+}
+
+// migrations are the ordered migrations of one kind of database.
+type migrations struct {
+	steps []migration
+	// lock is run first in every migration transaction, to serialize instances that start at once
+	lock string
+	// record marks a migration as applied, given its version, name and the time
+	record string
+}
+
+// loadMigrations merges the SQL migrations embedded for the database with the steps written in Go and
+// checks that their versions run from 1 without gaps. Both are part of the build, so it panics otherwise.
+func loadMigrations(database string, steps ...migration) []migration {
+	dir := path.Join("migrations", database)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, name, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+			panic(fmt.Sprintf("migration %s: the name is not <version>_<name>.sql", entry.Name()))
+		}
+		query, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		steps = append(steps, migration{version: version, name: name, up: func(tx Querier) error {
+			_, err := tx.Exec(string(query))
+			return err
+		}})
+	}
+
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].version < steps[j].version
+	})
+	for i, step := range steps {
+		if step.version != i+1 {
+			panic(fmt.Sprintf("migration %d %s: expected version %d", step.version, step.name, i+1))
+		}
+	}
+	return steps
+}
+
+// latest is the version of the schema this build knows.
+func (m migrations) latest() int {
+	return len(m.steps)
+}
+
+// version reads the version of the last migration applied to the database, 0 if it has none, creating
+// schema_migrations if it does not exist yet. A database newer than this build is refused.
+func (m migrations) version(tx Querier) (int, error) {
+	if m.lock != "" {
+		if _, err := tx.Exec(m.lock); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(createMigrationsTableQuery); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM ` + migrationsTableName).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	if version > m.latest() {
+		return 0, fmt.Errorf("%w: the database is at version %d, this build knows up to version %d", ErrSchemaTooNew, version, m.latest())
+	}
+	return version, nil
+}
+
+// check fails unless the database is at the version of this build.
+func (m migrations) check(ctx context.Context, db *sql.DB) error {
+	return WithTx(ctx, db, func(tx Querier) error {
+		version, err := m.version(tx)
+		if err != nil {
+			return err
+		}
+		if version < m.latest() {
+			return fmt.Errorf("%w: the database is at version %d, this build at version %d; run the migrate command", ErrSchemaOutdated, version, m.latest())
+		}
+		return nil
+	})
+}
+
+// migrate applies the migrations the database has not had yet, each in a transaction of its own
+// together with its row in schema_migrations, so an interrupted upgrade resumes where it stopped.
+func (m migrations) migrate(ctx context.Context, db *sql.DB) error {
+	from, to := -1, 0
+	for {
+		done := false
+		err := WithTx(ctx, db, func(tx Querier) error {
+			version, err := m.version(tx)
+			if err != nil {
+				return err
+			}
+			if from < 0 {
+				from = version
+			}
+			if version == m.latest() {
+				done = true
+				return nil
+			}
+
+			step := m.steps[version]
+			if err := step.up(tx); err != nil {
+				return fmt.Errorf("migration %d %s: %w", step.version, step.name, err)
+			}
+			_, err = tx.Exec(m.record, step.version, step.name, time.Now().UTC().Format(time.RFC3339))
+			to = step.version
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+
+	if to > from {
+		log.Printf("migrated database schema from version %d to %d", from, to)
+	}
+	return nil
+}
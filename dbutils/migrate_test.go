@@ -0,0 +1,170 @@
+package dbutils
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/regr76/timetravel/storage"
+)
+
+func Test_InitDB_UpgradesDatabaseWithoutSchemaVersion(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
+
+	// a database as the first build created it, with timestamps to the second
+	db, err := sql.Open("sqlite3", "file:"+filename)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+	CREATE TABLE records (
+		id INTEGER NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		start TEXT NOT NULL,
+		end TEXT,
+		data TEXT NOT NULL DEFAULT '{}',
+		PRIMARY KEY (id, version),
+		CHECK (json_valid(data))
+	) STRICT;
+	INSERT INTO records (id, version, start, end, data) VALUES
+		(1, 1, '20260101000000', '20260102000000', '{"a":"1"}'),
+		(1, 2, '20260102000000', '', '{"a":"2"}');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = InitDB(filename)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	versions, err := ReadAllVersions(db, 1)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "20260101000000000000000", versions[0].Start)
+	require.Equal(t, "20260101000000000000000", versions[0].ValidFrom)
+	require.Equal(t, "20260102000000000000000", versions[0].End)
+	require.Equal(t, storage.HashVersion(versions[0], ""), versions[0].Hash)
+	require.Equal(t, storage.HashVersion(versions[1], versions[0].Hash), versions[1].Hash)
+
+	var applied int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM `+migrationsTableName).Scan(&applied))
+	require.Equal(t, sqliteMigrations.latest(), applied)
+}
+
+func Test_InitDB_HashesAllColumnsOfIntactChains(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
+	db, err := InitDB(filename)
+	require.NoError(t, err)
+	for _, id := range []int{1, 2} {
+		require.NoError(t, WriteVersion(db, Row{ID: id, Version: 1, Start: "20260101000000000000000", End: "20260102000000000000000", Data: []byte(`{"a":"1"}`), Author: "alice"}))
+		require.NoError(t, WriteVersion(db, Row{ID: id, Version: 2, Start: "20260102000000000000000", Data: []byte(`{"a":"2"}`), Author: "bob"}))
+	}
+
+	// a database whose hashes were computed before they covered every column, with an edit to record 2
+	for _, id := range []int{1, 2} {
+		versions, err := ReadAllVersions(db, id)
+		require.NoError(t, err)
+		previousHash := ""
+		for _, row := range versions {
+			previousHash = legacyHashVersion(row, previousHash)
+			_, err = db.Exec(`UPDATE records SET hash = ? WHERE id = ? AND version = ?`, previousHash, row.ID, row.Version)
+			require.NoError(t, err)
+		}
+	}
+	_, err = db.Exec(`UPDATE records SET data = '{"a":"edited"}' WHERE id = 2 AND version = 2;
+		DELETE FROM ` + migrationsTableName + ` WHERE version >= 11`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = InitDB(filename)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	versions, err := ReadAllVersions(db, 1)
+	require.NoError(t, err)
+	require.Equal(t, storage.HashVersion(versions[0], ""), versions[0].Hash)
+	require.Equal(t, storage.HashVersion(versions[1], versions[0].Hash), versions[1].Hash)
+
+	// the edited version keeps its old hash and still fails verification
+	versions, err = ReadAllVersions(db, 2)
+	require.NoError(t, err)
+	require.Equal(t, storage.HashVersion(versions[0], ""), versions[0].Hash)
+	require.NotEqual(t, storage.HashVersion(versions[1], versions[0].Hash), versions[1].Hash)
+}
+
+func Test_InitDB_RefusesNewerDatabase(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
+	db, err := InitDB(filename)
+	require.NoError(t, err)
+
+	// a later build migrated the database further
+	_, err = db.Exec(`INSERT INTO `+migrationsTableName+` (version, name, applied) VALUES (?, 'later', '')`, sqliteMigrations.latest()+1)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = InitDB(filename)
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+	_, err = OpenDB(filename)
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+}
+
+func Test_OpenDB_RefusesOutdatedDatabase(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "unit-test.db")
+	db, err := InitDB(filename)
+	require.NoError(t, err)
+
+	// the database was last migrated by an earlier build
+	_, err = db.Exec(`DELETE FROM `+migrationsTableName+` WHERE version = ?`, sqliteMigrations.latest())
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = OpenDB(filename)
+	require.ErrorIs(t, err, ErrSchemaOutdated)
+
+	db, err = InitDB(filename)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	db, err = OpenDB(filename)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+}
+
+func Test_InitPostgres_ConcurrentInstances(t *testing.T) {
+	url, reason := launchPostgres(t)
+	if url == "" {
+		t.Skip(reason)
+	}
+
+	// instances starting at once apply each migration once
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := InitPostgres(url)
+			if err == nil {
+				err = db.Close()
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	db, err := OpenPostgres(url)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	var applied int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM `+migrationsTableName).Scan(&applied))
+	require.Equal(t, postgresMigrations.latest(), applied)
+}
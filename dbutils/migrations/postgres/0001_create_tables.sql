@@ -0,0 +1,44 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- The timestamps are kept as the text the services compare, as in SQLite. recorded and valid repeat the
+-- transaction time and the valid time as ranges, to microseconds: the exclusion constraint forbids two
+-- versions of a record from being current at the same time. Valid time ranges do overlap, as a
+-- retroactive correction is valid during the time of the version it corrects.
+-- data is json rather than jsonb, which keeps the text the hash of the version covers.
+CREATE TABLE IF NOT EXISTS records (
+	id BIGINT NOT NULL,
+	version INTEGER NOT NULL,
+	start TEXT NOT NULL,
+	"end" TEXT NOT NULL DEFAULT '',
+	valid_from TEXT NOT NULL DEFAULT '',
+	valid_to TEXT NOT NULL DEFAULT '',
+	data JSON NOT NULL DEFAULT '{}',
+	record_type TEXT NOT NULL DEFAULT '',
+	schema_version INTEGER NOT NULL DEFAULT 0,
+	deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	author TEXT NOT NULL DEFAULT '',
+	reason TEXT NOT NULL DEFAULT '',
+	source TEXT NOT NULL DEFAULT '',
+	hash TEXT NOT NULL DEFAULT '',
+	recorded TSTZRANGE NOT NULL,
+	valid TSTZRANGE NOT NULL,
+	PRIMARY KEY (id, version),
+	EXCLUDE USING gist (id WITH =, recorded WITH &&)
+);
+
+CREATE TABLE IF NOT EXISTS schemas (
+	record_type TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	created TEXT NOT NULL,
+	schema JSON NOT NULL,
+	PRIMARY KEY (record_type, version)
+);
+
+CREATE TABLE IF NOT EXISTS checkpoints (
+	day TEXT NOT NULL PRIMARY KEY,
+	leaves INTEGER NOT NULL,
+	root TEXT NOT NULL,
+	created TEXT NOT NULL,
+	signature TEXT NOT NULL,
+	public_key TEXT NOT NULL
+);
@@ -0,0 +1,5 @@
+-- Two versions of a record may not overlap in valid time while they overlap in transaction time, so at any
+-- moment the versions then current tell a single story of the valid time of the record. Valid time alone
+-- cannot be exclusive per record: a retroactive correction is valid during part of the time of the versions
+-- it corrects, which stay in the history.
+ALTER TABLE records ADD CONSTRAINT records_valid_excl EXCLUDE USING gist (id WITH =, valid WITH &&, recorded WITH &&);
@@ -0,0 +1,5 @@
+-- PostgreSQL keeps timestamps to the microsecond, so a range that starts and ends within one microsecond is
+-- empty, and an empty range overlaps nothing: the exclusion constraints would not apply to it. The services
+-- write versions a microsecond apart at least; any other write of an empty range fails. Rows stored before
+-- this migration are not checked.
+ALTER TABLE records ADD CONSTRAINT records_ranges_not_empty CHECK (NOT isempty(recorded) AND NOT isempty(valid)) NOT VALID;
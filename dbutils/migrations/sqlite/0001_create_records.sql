@@ -0,0 +1,12 @@
+-- the records table as it was first created; later migrations add the columns it has gained since
+CREATE TABLE IF NOT EXISTS records (
+	id INTEGER NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	start TEXT NOT NULL,
+	end TEXT,
+	data TEXT NOT NULL DEFAULT '{}',
+	PRIMARY KEY (id, version),
+
+	-- Ensure metadata always contains valid JSON
+	CHECK (json_valid(data))
+) STRICT;
@@ -0,0 +1,6 @@
+-- extend timestamps written with whole seconds (YYYYMMDDhhmmss) to the nanosecond form
+-- (YYYYMMDDhhmmssnnnnnnnnn), so old and new versions compare correctly as strings
+UPDATE records SET start = start || '000000000' WHERE length(start) = 14;
+UPDATE records SET end = end || '000000000' WHERE length(end) = 14;
+UPDATE records SET valid_from = valid_from || '000000000' WHERE length(valid_from) = 14;
+UPDATE records SET valid_to = valid_to || '000000000' WHERE length(valid_to) = 14;
@@ -0,0 +1,10 @@
+-- the JSON schemas of the record types, one row per version of a type's schema
+CREATE TABLE IF NOT EXISTS schemas (
+	record_type TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	created TEXT NOT NULL,
+	schema TEXT NOT NULL,
+	PRIMARY KEY (record_type, version),
+
+	CHECK (json_valid(schema))
+) STRICT;
@@ -0,0 +1,10 @@
+-- a checkpoint is the signed Merkle root over the versions that started on a day (UTC, YYYYMMDD),
+-- with the public key that verifies the signature
+CREATE TABLE IF NOT EXISTS checkpoints (
+	day TEXT NOT NULL PRIMARY KEY,
+	leaves INTEGER NOT NULL,
+	root TEXT NOT NULL,
+	created TEXT NOT NULL,
+	signature TEXT NOT NULL,
+	public_key TEXT NOT NULL
+) STRICT;
@@ -0,0 +1,3 @@
+-- the data keys records are most often searched by; the expressions match the ones of dataKeyExpression
+CREATE INDEX IF NOT EXISTS records_data_state ON records (json_extract(data, '$.state'));
+CREATE INDEX IF NOT EXISTS records_data_industry ON records (json_extract(data, '$.industry'));
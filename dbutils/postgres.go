@@ -0,0 +1,347 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/regr76/timetravel/storage"
+)
+
+const (
+	// postgresColumns are the columns scanned into a Row; end is a keyword in PostgreSQL.
+	postgresColumns = `id, version, start, "end", valid_from, valid_to, data, record_type, schema_version, deleted, author, reason, source, hash`
+	// postgresLockKey serializes the migrations when several instances start at once.
+	postgresLockKey = 7607
+	// PostgreSQL error codes of a write that lost the race for a version to another writer
+	postgresUniqueViolation    = "23505"
+	postgresExclusionViolation = "23P01"
+)
+
+// postgresMigrations bring a PostgreSQL database up to the schema of this build.
+var postgresMigrations = migrations{
+	steps: loadMigrations("postgres",
+		migration{version: 3, name: "hash_all_columns", up: migrateHashAllColumns(
+			`SELECT `+postgresColumns+` FROM `+tableName+` ORDER BY id ASC, version ASC`,
+			`UPDATE `+tableName+` SET hash = $1 WHERE id = $2 AND version = $3`)},
+		migration{version: 4, name: "data_key_text_indexes", up: createDataKeyIndexes(postgresDataKeyExpression)},
+	),
+	lock:   `SELECT pg_advisory_xact_lock(` + strconv.Itoa(postgresLockKey) + `)`,
+	record: `INSERT INTO ` + migrationsTableName + ` (version, name, applied) VALUES ($1, $2, $3)`,
+}
+
+// InitPostgres opens the PostgreSQL database at the URL (or key=value connection string) and applies the
+// migrations it has not had yet. Unlike the SQLite database, it can be shared by several instances.
+func InitPostgres(url string) (*sql.DB, error) {
+	return openPostgres(url, postgresMigrations.migrate)
+}
+
+// OpenPostgres opens the PostgreSQL database at the URL without changing its schema. It fails with
+// ErrSchemaOutdated if the database has migrations to apply, and with ErrSchemaTooNew if it is newer
+// than this build.
+func OpenPostgres(url string) (*sql.DB, error) {
+	return openPostgres(url, postgresMigrations.check)
+}
+
+func openPostgres(url string, prepare func(ctx context.Context, db *sql.DB) error) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err == nil {
+		err = prepare(context.Background(), db)
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// PostgresStore is the PostgreSQL adapter of storage.Store. It has no full-text index.
+type PostgresStore struct {
+	postgresQueries
+	db *sql.DB
+}
+
+var _ storage.Store = (*PostgresStore)(nil)
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{postgresQueries: postgresQueries{q: db}, db: db}
+}
+
+// Update runs fn in a transaction of the database.
+func (s *PostgresStore) Update(ctx context.Context, fn func(tx storage.Tx) error) error {
+	return WithTx(ctx, s.db, func(tx Querier) error {
+		return fn(&postgresTx{postgresQueries{q: tx}})
+	})
+}
+
+// postgresTx is the storage.Tx of a transaction opened by PostgresStore.Update.
+type postgresTx struct {
+	postgresQueries
+}
+
+func (tx *postgresTx) Savepoint(fn func() error) error {
+	return WithSavepoint(tx.q, fn)
+}
+
+// postgresQueries implements the reads and writes of the store on the database or on a transaction.
+type postgresQueries struct {
+	q Querier
+}
+
+// postgresArgs collects the arguments of a query and numbers their placeholders.
+type postgresArgs []any
+
+func (a *postgresArgs) add(value any) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// postgresTimestamp converts a timestamp of the services (YYYYMMDDhhmmssnnnnnnnnn, UTC) to a PostgreSQL
+// timestamp, which has microseconds. An empty timestamp is NULL, the unbounded end of a range.
+func postgresTimestamp(timestamp string) any {
+	if len(timestamp) < 14 {
+		return nil
+	}
+	fraction := (timestamp[14:] + "000000")[:6]
+	return timestamp[0:4] + "-" + timestamp[4:6] + "-" + timestamp[6:8] + " " +
+		timestamp[8:10] + ":" + timestamp[10:12] + ":" + timestamp[12:14] + "." + fraction + "+00"
+}
+
+// isPostgresConflict reports whether a write failed because another writer stored the version first.
+func isPostgresConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == postgresUniqueViolation || pqErr.Code == postgresExclusionViolation)
+}
+
+func (s postgresQueries) readRow(query string, args ...any) (*Row, error) {
+	row, err := scanRow(s.q.QueryRow(`SELECT `+postgresColumns+` FROM `+tableName+` WHERE `+query, args...))
+	return row, notFound(err)
+}
+
+func (s postgresQueries) readRows(query string, args ...any) ([]Row, error) {
+	rows, err := s.q.Query(`SELECT `+postgresColumns+` FROM `+tableName+` WHERE `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows)
+}
+
+func (s postgresQueries) ReadLatest(id int) (*Row, error) {
+	return s.readRow(`id = $1 ORDER BY version DESC LIMIT 1`, id)
+}
+
+func (s postgresQueries) ReadVersion(id int, version int) (*Row, error) {
+	return s.readRow(`id = $1 AND version = $2`, id, version)
+}
+
+func (s postgresQueries) ReadAt(id int, at string) (*Row, error) {
+	return s.readRow(`id = $1 AND start <= $2 AND ("end" = '' OR "end" > $2) ORDER BY version DESC LIMIT 1`, id, at)
+}
+
+func (s postgresQueries) ReadAsOf(id int, knownAt string, validAt string) (*Row, error) {
+	return s.readRow(`id = $1 AND start <= $2 AND valid_from <= $3 AND (valid_to = '' OR valid_to > $3) ORDER BY version DESC LIMIT 1`, id, knownAt, validAt)
+}
+
+func (s postgresQueries) ReadRange(id int, fromVersion int, toVersion int) ([]Row, error) {
+	if toVersion == 0 {
+		return s.readRows(`id = $1 AND version >= $2 ORDER BY version ASC`, id, fromVersion)
+	}
+	return s.readRows(`id = $1 AND version >= $2 AND version <= $3 ORDER BY version ASC`, id, fromVersion, toVersion)
+}
+
+// postgresDataKeyExpression is the expression of the value of a plain data key as v2 shows it, as
+// dataKeyExpression is in SQLite. The key is written as a literal so that the expression matches the one
+// of an index on the key.
+func postgresDataKeyExpression(key string) string {
+	return postgresDataKeyTerm(`'` + key + `'`)
+}
+
+// postgresDataKeyTerm is the expression of the value of the data key given as a SQL term: strings as
+// they are, other values as their JSON text.
+func postgresDataKeyTerm(key string) string {
+	return `CASE json_typeof(data->` + key + `) WHEN 'string' THEN data->>` + key + ` ELSE (data->` + key + `)::text END`
+}
+
+func (s postgresQueries) ScanCurrent(at string, filters []DataFilter, afterID int, limit int) ([]Row, error) {
+	args := postgresArgs{}
+	query := `id > ` + args.add(afterID) + ` AND start <= ` + args.add(at) + ` AND ("end" = '' OR "end" > $2) AND NOT deleted`
+	for _, filter := range filters {
+		if filter.Key == "" || strings.Contains(filter.Key, `"`) {
+			return nil, ErrDataKeyInvalid
+		}
+		if plainKeyPattern.MatchString(filter.Key) {
+			query += ` AND ` + postgresDataKeyExpression(filter.Key) + ` = ` + args.add(filter.Value)
+		} else {
+			query += ` AND ` + postgresDataKeyTerm(args.add(filter.Key)+`::text`) + ` = ` + args.add(filter.Value)
+		}
+	}
+	query += ` ORDER BY id ASC LIMIT ` + args.add(limit)
+	return s.readRows(query, args...)
+}
+
+func (s postgresQueries) Scan(filter RowFilter, afterID int, afterVersion int, limit int) ([]Row, error) {
+	args := postgresArgs{}
+	query := `(id, version) > (` + args.add(afterID) + `, ` + args.add(afterVersion) + `)`
+	if filter.FromID > 0 {
+		query += ` AND id >= ` + args.add(filter.FromID)
+	}
+	if filter.ToID > 0 {
+		query += ` AND id <= ` + args.add(filter.ToID)
+	}
+	if filter.Since != "" {
+		query += ` AND ("end" = '' OR "end" > ` + args.add(filter.Since) + `)`
+	}
+	if filter.Until != "" {
+		query += ` AND start < ` + args.add(filter.Until)
+	}
+	query += ` ORDER BY id ASC, version ASC LIMIT ` + args.add(limit)
+	return s.readRows(query, args...)
+}
+
+func (s postgresQueries) ReadDay(day string) ([]Row, error) {
+	return s.readRows(`substr(start, 1, 8) = $1 ORDER BY start ASC, id ASC, version ASC`, day)
+}
+
+func (s postgresQueries) ReadSchema(recordType string, version int) (*SchemaRow, error) {
+	query := `SELECT ` + schemaColumns + ` FROM ` + schemasTableName + ` WHERE record_type = $1`
+	args := []any{recordType}
+	if version == 0 {
+		query += ` ORDER BY version DESC LIMIT 1`
+	} else {
+		query += ` AND version = $2`
+		args = append(args, version)
+	}
+	row, err := scanSchemaRow(s.q.QueryRow(query, args...))
+	return row, notFound(err)
+}
+
+func (s postgresQueries) ReadCheckpoint(day string) (*CheckpointRow, error) {
+	query := `SELECT ` + checkpointColumns + ` FROM ` + checkpointsTableName + ` WHERE day = $1`
+	row, err := scanCheckpointRow(s.q.QueryRow(query, day))
+	return row, notFound(err)
+}
+
+func (s postgresQueries) ReadDaysWithoutCheckpoint(before string) ([]string, error) {
+	query := `SELECT DISTINCT substr(start, 1, 8) AS day FROM ` + tableName + ` WHERE start < $1
+		AND substr(start, 1, 8) NOT IN (SELECT day FROM ` + checkpointsTableName + `) ORDER BY day ASC`
+	rows, err := s.q.Query(query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var days []string
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+func (s postgresQueries) Search(query string, at string, limit int) ([]SearchHit, error) {
+	return nil, storage.ErrSearchUnavailable
+}
+
+// previousHash reads the hash of the version preceding the row; the first version has none.
+func (s postgresQueries) previousHash(row Row) (string, error) {
+	if row.Version <= 1 {
+		return "", nil
+	}
+	var hash string
+	err := s.q.QueryRow(`SELECT hash FROM `+tableName+` WHERE id = $1 AND version = $2`, row.ID, row.Version-1).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// Append checks that the record is at the preceding version before inserting; a writer that inserted the
+// version in the meantime makes the insert fail on the primary key or the exclusion constraint.
+func (s postgresQueries) Append(row Row) error {
+	var latest int
+	err := s.q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM `+tableName+` WHERE id = $1`, row.ID).Scan(&latest)
+	if err != nil {
+		return err
+	}
+	if latest != row.Version-1 {
+		return ErrVersionConflict
+	}
+	previousHash, err := s.previousHash(row)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO ` + tableName + ` (` + postgresColumns + `, recorded, valid) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+		tstzrange($15::timestamptz, $16::timestamptz, '[)'), tstzrange($17::timestamptz, $18::timestamptz, '[)'))`
+	_, err = s.q.Exec(query, row.ID, row.Version, row.Start, row.End, row.ValidFrom, row.ValidTo, string(row.Data), row.RecordType, row.SchemaVersion, row.Deleted, row.Author, row.Reason, row.Source, storage.HashVersion(row, previousHash),
+		postgresTimestamp(row.Start), postgresTimestamp(row.End), postgresTimestamp(row.ValidFrom), postgresTimestamp(row.ValidTo))
+	if isPostgresConflict(err) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+func (s postgresQueries) CloseVersion(id int, version int, end string) error {
+	row, err := s.ReadVersion(id, version)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	previousHash, err := s.previousHash(*row)
+	if err != nil {
+		return err
+	}
+	if row.Hash != storage.HashVersion(*row, previousHash) {
+		return storage.ErrHashMismatch
+	}
+	row.End = end
+
+	query := `UPDATE ` + tableName + ` SET "end" = $1, hash = $2, recorded = tstzrange(lower(recorded), $3::timestamptz, '[)') WHERE id = $4 AND version = $5`
+	_, err = s.q.Exec(query, end, storage.HashVersion(*row, previousHash), postgresTimestamp(end), id, version)
+	if isPostgresConflict(err) {
+		// another writer closed the version and added the next one first
+		return ErrVersionConflict
+	}
+	return err
+}
+
+func (s postgresQueries) AppendSchema(recordType string, created string, schema []byte) (int, error) {
+	query := `INSERT INTO ` + schemasTableName + ` (` + schemaColumns + `)
+		SELECT $1::text, COALESCE(MAX(version), 0) + 1, $2::text, $3::json FROM ` + schemasTableName + ` WHERE record_type = $1::text
+		RETURNING version`
+	var version int
+	err := s.q.QueryRow(query, recordType, created, string(schema)).Scan(&version)
+	return version, err
+}
+
+func (s postgresQueries) WriteCheckpoint(row CheckpointRow) error {
+	query := `INSERT INTO ` + checkpointsTableName + ` (` + checkpointColumns + `) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (day) DO NOTHING`
+	result, err := s.q.Exec(query, row.Day, row.Leaves, row.Root, row.Created, row.Signature, row.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrCheckpointExists
+	}
+	return nil
+}
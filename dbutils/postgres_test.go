@@ -0,0 +1,115 @@
+package dbutils
+
+import (
+	"database/sql"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/regr76/timetravel/storage"
+)
+
+// postgresBinary finds a PostgreSQL program on the PATH or where Debian and Ubuntu install it.
+func postgresBinary(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err == nil {
+		return path, nil
+	}
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql/*/bin", name))
+	if len(matches) > 0 {
+		return matches[len(matches)-1], nil
+	}
+	return "", err
+}
+
+// launchPostgres starts a PostgreSQL server of its own for the test, listening on a socket in a temporary
+// directory, and returns the connection string of its database. Without a server to launch, it returns
+// an empty string and the reason.
+func launchPostgres(t *testing.T) (string, string) {
+	initdb, err := postgresBinary("initdb")
+	if err != nil {
+		return "", "initdb not found; install PostgreSQL to run the PostgreSQL tests"
+	}
+	pgCtl, err := postgresBinary("pg_ctl")
+	if err != nil {
+		return "", "pg_ctl not found; install PostgreSQL to run the PostgreSQL tests"
+	}
+	if os.Geteuid() == 0 {
+		return "", "PostgreSQL refuses to run as root"
+	}
+
+	// a short directory, as the path of the socket is limited to about 100 bytes
+	dir, err := os.MkdirTemp("", "pg")
+	require.NoError(t, err)
+	data := filepath.Join(dir, "data")
+	output, err := exec.Command(initdb, "-D", data, "-U", "postgres", "--auth=trust", "--no-sync", "-E", "UTF8").CombinedOutput()
+	require.NoError(t, err, string(output))
+	output, err = exec.Command(pgCtl, "-D", data, "-l", filepath.Join(dir, "log"), "-w", "-o", "-c listen_addresses='' -k "+dir, "start").CombinedOutput()
+	require.NoError(t, err, string(output))
+	t.Cleanup(func() {
+		_ = exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+		_ = os.RemoveAll(dir)
+	})
+
+	return "host=" + dir + " user=postgres dbname=postgres sslmode=disable", ""
+}
+
+// openTestPostgres opens the database of a launched server, closing it when the test ends.
+func openTestPostgres(t *testing.T, url string) *sql.DB {
+	db, err := InitPostgres(url)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func Test_PostgresStore_ExcludesOverlappingVersions(t *testing.T) {
+	url, reason := launchPostgres(t)
+	if url == "" {
+		t.Skip(reason)
+	}
+	db := openTestPostgres(t, url)
+	store := NewPostgresStore(db)
+
+	require.NoError(t, store.Append(Row{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"a":"1"}`)}))
+	require.NoError(t, store.CloseVersion(1, 1, "20260102000000000000000"))
+	require.NoError(t, store.Append(Row{ID: 1, Version: 2, Start: "20260102000000000000000", ValidFrom: "20251201000000000000000", Data: []byte(`{"a":"2"}`)}))
+
+	// a version written past the check of Append, as by a concurrent writer, may not be current alongside another
+	_, err := db.Exec(`INSERT INTO records (` + postgresColumns + `, recorded, valid) VALUES (1, 3, '20260101120000000000000', '', '', '', '{}', '', 0, FALSE, '', '', '', '',
+		tstzrange('2026-01-01 12:00:00+00', NULL, '[)'), tstzrange(NULL, NULL))`)
+	require.ErrorContains(t, err, "conflicting key value violates exclusion constraint")
+	require.True(t, isPostgresConflict(err))
+
+	// and no two versions current at once may overlap in valid time
+	var definition string
+	require.NoError(t, db.QueryRow(`SELECT pg_get_constraintdef(oid) FROM pg_constraint WHERE conname = 'records_valid_excl'`).Scan(&definition))
+	require.Equal(t, "EXCLUDE USING gist (id WITH =, valid WITH &&, recorded WITH &&)", definition)
+
+	// a version current within one microsecond would escape the constraints, so it is refused
+	err = store.Append(Row{ID: 2, Version: 1, Start: "20260101000000000000100", End: "20260101000000000000900", ValidFrom: "20260101000000000000000", Data: []byte(`{}`)})
+	require.ErrorContains(t, err, "records_ranges_not_empty")
+
+	// the data is kept as written, so the hashes still match
+	versions, err := store.ReadRange(1, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, storage.HashVersion(versions[0], ""), versions[0].Hash)
+	require.Equal(t, storage.HashVersion(versions[1], versions[0].Hash), versions[1].Hash)
+	require.Equal(t, `{"a":"2"}`, string(versions[1].Data))
+
+	// the tables are left as they are when another instance starts
+	latest, err := NewPostgresStore(openTestPostgres(t, url)).ReadLatest(1)
+	require.NoError(t, err)
+	require.Equal(t, versions[1], *latest)
+}
+
+func Test_PostgresTimestamp(t *testing.T) {
+	require.Equal(t, "2026-03-01 12:00:00.123456+00", postgresTimestamp("20260301120000123456789"))
+	require.Equal(t, "2026-03-01 12:00:00.000000+00", postgresTimestamp("20260301120000"))
+	require.Nil(t, postgresTimestamp(""))
+}
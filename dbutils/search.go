@@ -0,0 +1,178 @@
+package dbutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/regr76/timetravel/storage"
+)
+
+const (
+	searchTableName = "records_fts"
+	// the full-text index holds, for every version that is not a tombstone, the text and numbers found anywhere
+	// in its data. Triggers keep it in step with the records table; versions are never rewritten, only closed.
+	createSearchTableQuery = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS ` + searchTableName + ` USING fts5(
+		id UNINDEXED,
+		version UNINDEXED,
+		text
+	);
+	`
+	// searchTextOfNew and searchTextOfData join the text and numbers of the data being inserted or stored. The
+	// characters that mark the matches of a snippet are separators to FTS5; they are indexed as spaces, so that
+	// a snippet contains them only around matches
+	searchTextOfNew     = `(SELECT COALESCE(group_concat(` + searchTextOfAtom + `, ' '), '') FROM json_tree(NEW.data) WHERE type IN ('text', 'integer', 'real'))`
+	searchTextOfData    = `(SELECT COALESCE(group_concat(` + searchTextOfAtom + `, ' '), '') FROM json_tree(data) WHERE type IN ('text', 'integer', 'real'))`
+	searchTextOfAtom    = `replace(replace(atom, char(2), ' '), char(3), ' ')`
+	snippetMarkStart    = "\x02"
+	snippetMarkEnd      = "\x03"
+	insertTriggerName   = searchTableName + `_insert`
+	createTriggersQuery = `
+	CREATE TRIGGER IF NOT EXISTS ` + insertTriggerName + ` AFTER INSERT ON ` + tableName + ` WHEN NEW.deleted = 0 BEGIN
+		INSERT INTO ` + searchTableName + ` (id, version, text) VALUES (NEW.id, NEW.version, ` + searchTextOfNew + `);
+	END;
+	CREATE TRIGGER IF NOT EXISTS ` + searchTableName + `_delete AFTER DELETE ON ` + tableName + ` BEGIN
+		DELETE FROM ` + searchTableName + ` WHERE id = OLD.id AND version = OLD.version;
+	END;
+	`
+	dropTriggersQuery = `
+	DROP TRIGGER IF EXISTS ` + insertTriggerName + `;
+	DROP TRIGGER IF EXISTS ` + searchTableName + `_delete;
+	`
+	rebuildSearchQuery = `
+	DELETE FROM ` + searchTableName + `;
+	INSERT INTO ` + searchTableName + ` (id, version, text)
+		SELECT id, version, ` + searchTextOfData + ` FROM ` + tableName + ` WHERE deleted = 0;
+	`
+)
+
+// ErrSearchUnavailable is returned when SQLite was built without FTS5 (the sqlite_fts5 build tag).
+var ErrSearchUnavailable = fmt.Errorf("%w; build with the sqlite_fts5 tag", storage.ErrSearchUnavailable)
+
+// ErrSearchQueryInvalid is returned for a query that is not valid FTS5 query syntax.
+var ErrSearchQueryInvalid = storage.ErrSearchQueryInvalid
+
+// initSearch creates the full-text index if SQLite supports FTS5. Without FTS5 the triggers are dropped,
+// so that writes keep working on a database created by a build with FTS5; the index is rebuilt once such a
+// build opens the database again.
+func initSearch(db *sql.DB) error {
+	// an existing index is not created again, so it has to be read to find out whether FTS5 is there
+	_, err := db.Exec(createSearchTableQuery)
+	if err == nil {
+		_, err = db.Exec(`SELECT 1 FROM ` + searchTableName + ` LIMIT 0`)
+	}
+	if isMissingFTS5(err) {
+		_, err = db.Exec(dropTriggersQuery)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	var trigger string
+	err = db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = ?`, insertTriggerName).Scan(&trigger)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if strings.Contains(trigger, searchTextOfNew) {
+		return nil
+	}
+
+	// the index is new, missed writes made without FTS5, or holds the text of an earlier build
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{dropTriggersQuery, rebuildSearchQuery, createTriggersQuery} {
+		if _, err := tx.Exec(query); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func isMissingFTS5(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such module: fts5")
+}
+
+// SearchAvailable reports whether the database has a full-text index.
+func SearchAvailable(db Querier) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?`, insertTriggerName).Scan(&count)
+	return count > 0, err
+}
+
+// SearchHit is a version whose data matched a full-text query, with an extract of the matching text,
+// escaped as HTML, in which the matched terms are enclosed in <mark> and </mark>.
+type SearchHit = storage.SearchHit
+
+// SearchVersions reads at most limit versions whose data matches the FTS5 query, best matches first.
+// With a non-empty at, only the versions current at that time are searched, otherwise all versions.
+// Tombstones are never matched.
+func SearchVersions(db Querier, query string, at string, limit int) ([]SearchHit, error) {
+	available, err := SearchAvailable(db)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, ErrSearchUnavailable
+	}
+
+	statement := `SELECT f.id, f.version, snippet(` + searchTableName + `, 2, char(2), char(3), '…', 12)
+		FROM ` + searchTableName + ` f JOIN ` + tableName + ` r ON r.id = f.id AND r.version = f.version
+		WHERE f.text MATCH ? AND r.deleted = 0`
+	args := []any{query}
+	if at != "" {
+		statement += ` AND r.start <= ? AND (r.end = '' OR r.end > ?)`
+		args = append(args, at, at)
+	}
+	statement += ` ORDER BY f.rank, f.id, f.version LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(statement, args...)
+	if err != nil {
+		return nil, searchError(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		if err := rows.Scan(&hit.ID, &hit.Version, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		hit.Snippet = markSnippet(hit.Snippet)
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, searchError(err)
+	}
+	return hits, nil
+}
+
+// snippetMarks turns the marks of a snippet into HTML once the text has been escaped.
+var snippetMarks = strings.NewReplacer(snippetMarkStart, "<mark>", snippetMarkEnd, "</mark>")
+
+// markSnippet escapes the data of a snippet as HTML and encloses the matches in <mark> and </mark>.
+func markSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
+
+// searchQueryErrors are the messages with which FTS5 rejects a query it cannot parse.
+var searchQueryErrors = []string{"fts5: syntax error", "unterminated string", "no such column", "unknown special query"}
+
+// searchError tells a query SQLite could not parse apart from other failures.
+func searchError(err error) error {
+	for _, message := range searchQueryErrors {
+		if strings.Contains(err.Error(), message) {
+			return ErrSearchQueryInvalid
+		}
+	}
+	return err
+}
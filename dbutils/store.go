@@ -0,0 +1,124 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/regr76/timetravel/storage"
+)
+
+// Store is the SQLite adapter of storage.Store, built on the read and write functions of this package.
+type Store struct {
+	queries
+	db *sql.DB
+}
+
+var _ storage.Store = (*Store)(nil)
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{queries: queries{q: db}, db: db}
+}
+
+// Update runs fn in a transaction of the database.
+func (s *Store) Update(ctx context.Context, fn func(tx storage.Tx) error) error {
+	return WithTx(ctx, s.db, func(tx Querier) error {
+		return fn(&storeTx{queries{q: tx}})
+	})
+}
+
+// storeTx is the storage.Tx of a transaction opened by Store.Update.
+type storeTx struct {
+	queries
+}
+
+func (tx *storeTx) Savepoint(fn func() error) error {
+	return WithSavepoint(tx.q, fn)
+}
+
+// queries implements the reads and writes of the store on the database or on a transaction.
+type queries struct {
+	q Querier
+}
+
+// notFound turns the error of a single row query that found nothing into storage.ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+	return err
+}
+
+func (s queries) ReadLatest(id int) (*Row, error) {
+	row, err := ReadLatestVersion(s.q, id)
+	return row, notFound(err)
+}
+
+func (s queries) ReadVersion(id int, version int) (*Row, error) {
+	row, err := ReadOneVersion(s.q, id, version)
+	return row, notFound(err)
+}
+
+func (s queries) ReadAt(id int, at string) (*Row, error) {
+	row, err := ReadVersionAt(s.q, id, at)
+	return row, notFound(err)
+}
+
+func (s queries) ReadAsOf(id int, knownAt string, validAt string) (*Row, error) {
+	row, err := ReadVersionAsOf(s.q, id, knownAt, validAt)
+	return row, notFound(err)
+}
+
+func (s queries) ReadRange(id int, fromVersion int, toVersion int) ([]Row, error) {
+	return ReadVersionRange(s.q, id, fromVersion, toVersion)
+}
+
+func (s queries) ScanCurrent(at string, filters []DataFilter, afterID int, limit int) ([]Row, error) {
+	return ReadVersionsWhere(s.q, at, filters, afterID, limit)
+}
+
+func (s queries) Scan(filter RowFilter, afterID int, afterVersion int, limit int) ([]Row, error) {
+	return ReadRowsPage(s.q, filter, afterID, afterVersion, limit)
+}
+
+func (s queries) ReadDay(day string) ([]Row, error) {
+	return ReadDayVersions(s.q, day)
+}
+
+func (s queries) ReadSchema(recordType string, version int) (*SchemaRow, error) {
+	if version == 0 {
+		row, err := ReadLatestSchema(s.q, recordType)
+		return row, notFound(err)
+	}
+	row, err := ReadSchema(s.q, recordType, version)
+	return row, notFound(err)
+}
+
+func (s queries) ReadCheckpoint(day string) (*CheckpointRow, error) {
+	row, err := ReadCheckpoint(s.q, day)
+	return row, notFound(err)
+}
+
+func (s queries) ReadDaysWithoutCheckpoint(before string) ([]string, error) {
+	return ReadDaysWithoutCheckpoint(s.q, before)
+}
+
+func (s queries) Search(query string, at string, limit int) ([]SearchHit, error) {
+	return SearchVersions(s.q, query, at, limit)
+}
+
+func (s queries) Append(row Row) error {
+	return WriteNextVersion(s.q, row)
+}
+
+func (s queries) CloseVersion(id int, version int, end string) error {
+	return UpdateVersion(s.q, id, version, end)
+}
+
+func (s queries) AppendSchema(recordType string, created string, schema []byte) (int, error) {
+	return WriteNextSchema(s.q, recordType, created, schema)
+}
+
+func (s queries) WriteCheckpoint(row CheckpointRow) error {
+	return WriteCheckpoint(s.q, row)
+}
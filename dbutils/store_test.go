@@ -0,0 +1,175 @@
+package dbutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/regr76/timetravel/storage"
+)
+
+// Test_Store_MatchesMemoryStore writes the same history to the SQLite store, the PostgreSQL store if a server
+// can be launched, and the in-memory store the tests of the services use in their place, and checks that
+// all of them read it back alike.
+func Test_Store_MatchesMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	stores := map[string]storage.Store{
+		"sqlite": NewStore(newTestDB(t)),
+		"memory": storage.NewMemoryStore(),
+	}
+	if url, reason := launchPostgres(t); url != "" {
+		stores["postgres"] = NewPostgresStore(openTestPostgres(t, url))
+	} else {
+		t.Log(reason)
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			err := store.Update(ctx, func(tx storage.Tx) error {
+				for _, row := range []Row{
+					{ID: 1, Version: 1, Start: "20260101000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(`{"state":"CA","size":3,"open":true,"limits":{"a":[1.50,null]}}`)},
+					{ID: 2, Version: 1, Start: "20260101000000000000001", ValidFrom: "20260101000000000000001", Data: []byte(`{"state":"NV","the key":"x"}`)},
+					{ID: 3, Version: 1, Start: "20260102000000000000000", ValidFrom: "20260102000000000000000", Data: []byte(`{"state":"CA"}`), Author: "alice"},
+				} {
+					if err := tx.Append(row); err != nil {
+						return err
+					}
+				}
+				if err := tx.CloseVersion(1, 1, "20260103000000000000000"); err != nil {
+					return err
+				}
+				return tx.Append(Row{ID: 1, Version: 2, Start: "20260103000000000000000", ValidFrom: "20251201000000000000000", ValidTo: "20260201000000000000000", Data: []byte(`{"state":"NV"}`)})
+			})
+			require.NoError(t, err)
+
+			// a failed update leaves nothing behind, a failed savepoint only undoes its own writes
+			err = store.Update(ctx, func(tx storage.Tx) error {
+				require.NoError(t, tx.Append(Row{ID: 4, Version: 1, Start: "20260104000000000000000", Data: []byte(`{}`)}))
+				return errInjected
+			})
+			require.ErrorIs(t, err, errInjected)
+			err = store.Update(ctx, func(tx storage.Tx) error {
+				err := tx.Savepoint(func() error {
+					require.NoError(t, tx.Append(Row{ID: 5, Version: 1, Start: "20260104000000000000000", Data: []byte(`{}`)}))
+					return errInjected
+				})
+				require.ErrorIs(t, err, errInjected)
+				return tx.Append(Row{ID: 6, Version: 1, Start: "20260104000000000000000", Data: []byte(`{}`)})
+			})
+			require.NoError(t, err)
+			for id, want := range map[int]error{4: storage.ErrNotFound, 5: storage.ErrNotFound, 6: nil} {
+				_, err := store.ReadLatest(id)
+				require.ErrorIs(t, err, want, "record %d", id)
+			}
+
+			require.ErrorIs(t, store.Append(Row{ID: 1, Version: 2, Start: "20260105000000000000000", Data: []byte(`{}`)}), storage.ErrVersionConflict)
+			require.ErrorIs(t, store.Append(Row{ID: 7, Version: 2, Start: "20260105000000000000000", Data: []byte(`{}`)}), storage.ErrVersionConflict)
+
+			version, err := store.AppendSchema("company", "20260101000000000000000", []byte(`{"type":"object"}`))
+			require.NoError(t, err)
+			require.Equal(t, 1, version)
+			version, err = store.AppendSchema("company", "20260102000000000000000", []byte(`{"type":"object","required":["state"]}`))
+			require.NoError(t, err)
+			require.Equal(t, 2, version)
+
+			checkpoint := CheckpointRow{Day: "20260101", Leaves: 2, Root: "00", Created: "20260102000000000000000", Signature: "01", PublicKey: "02"}
+			require.NoError(t, store.WriteCheckpoint(checkpoint))
+			require.ErrorIs(t, store.WriteCheckpoint(checkpoint), storage.ErrCheckpointExists)
+
+			latest, err := store.ReadLatest(1)
+			require.NoError(t, err)
+			require.Equal(t, 2, latest.Version)
+			first, err := store.ReadVersion(1, 1)
+			require.NoError(t, err)
+			require.Equal(t, "20260103000000000000000", first.End)
+			require.Equal(t, storage.HashVersion(*first, ""), first.Hash)
+			require.Equal(t, storage.HashVersion(*latest, first.Hash), latest.Hash)
+			_, err = store.ReadVersion(1, 3)
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			at, err := store.ReadAt(1, "20260102000000000000000")
+			require.NoError(t, err)
+			require.Equal(t, 1, at.Version)
+			_, err = store.ReadAt(3, "20260101000000000000000")
+			require.ErrorIs(t, err, storage.ErrNotFound)
+			asOf, err := store.ReadAsOf(1, "20260104000000000000000", "20251215000000000000000")
+			require.NoError(t, err)
+			require.Equal(t, 2, asOf.Version)
+			_, err = store.ReadAsOf(1, "20260104000000000000000", "20251115000000000000000")
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			versions, err := store.ReadRange(1, 1, 0)
+			require.NoError(t, err)
+			require.Equal(t, []Row{*first, *latest}, versions)
+			versions, err = store.ReadRange(1, 2, 2)
+			require.NoError(t, err)
+			require.Equal(t, []Row{*latest}, versions)
+			versions, err = store.ReadRange(9, 1, 0)
+			require.NoError(t, err)
+			require.Empty(t, versions)
+
+			ids := func(rows []Row) []int {
+				output := []int{}
+				for _, row := range rows {
+					output = append(output, row.ID*10+row.Version)
+				}
+				return output
+			}
+			for _, tc := range []struct {
+				at      string
+				filters []DataFilter
+				afterID int
+				limit   int
+				want    []int
+			}{
+				{"20260102120000000000000", nil, 0, 10, []int{11, 21, 31}},
+				{"20260104120000000000000", nil, 0, 10, []int{12, 21, 31, 61}},
+				{"20260104120000000000000", nil, 1, 2, []int{21, 31}},
+				{"20260102120000000000000", []DataFilter{{Key: "state", Value: "CA"}}, 0, 10, []int{11, 31}},
+				{"20260102120000000000000", []DataFilter{{Key: "size", Value: "3"}, {Key: "open", Value: "true"}}, 0, 10, []int{11}},
+				{"20260102120000000000000", []DataFilter{{Key: "limits", Value: `{"a":[1.50,null]}`}}, 0, 10, []int{11}},
+				{"20260102120000000000000", []DataFilter{{Key: "size", Value: "3.0"}}, 0, 10, []int{}},
+				{"20260102120000000000000", []DataFilter{{Key: "the key", Value: "x"}, {Key: "state", Value: "NV"}}, 0, 10, []int{21}},
+			} {
+				rows, err := store.ScanCurrent(tc.at, tc.filters, tc.afterID, tc.limit)
+				require.NoError(t, err)
+				require.Equal(t, tc.want, ids(rows), "%+v", tc)
+			}
+			_, err = store.ScanCurrent("20260102120000000000000", []DataFilter{{Key: `"`, Value: "x"}}, 0, 10)
+			require.ErrorIs(t, err, storage.ErrDataKeyInvalid)
+
+			rows, err := store.Scan(storage.RowFilter{}, 1, 1, 3)
+			require.NoError(t, err)
+			require.Equal(t, []int{12, 21, 31}, ids(rows))
+			rows, err = store.Scan(storage.RowFilter{FromID: 1, ToID: 2, Since: "20260103000000000000000"}, 0, 0, 10)
+			require.NoError(t, err)
+			require.Equal(t, []int{12, 21}, ids(rows))
+			rows, err = store.Scan(storage.RowFilter{Until: "20260102000000000000000"}, 0, 0, 10)
+			require.NoError(t, err)
+			require.Equal(t, []int{11, 21}, ids(rows))
+
+			rows, err = store.ReadDay("20260101")
+			require.NoError(t, err)
+			require.Equal(t, []int{11, 21}, ids(rows))
+			days, err := store.ReadDaysWithoutCheckpoint("20260104")
+			require.NoError(t, err)
+			require.Equal(t, []string{"20260102", "20260103"}, days)
+
+			schema, err := store.ReadSchema("company", 0)
+			require.NoError(t, err)
+			require.Equal(t, 2, schema.Version)
+			schema, err = store.ReadSchema("company", 1)
+			require.NoError(t, err)
+			require.JSONEq(t, `{"type":"object"}`, string(schema.Schema))
+			_, err = store.ReadSchema("person", 0)
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			stored, err := store.ReadCheckpoint("20260101")
+			require.NoError(t, err)
+			require.Equal(t, checkpoint, *stored)
+			_, err = store.ReadCheckpoint("20260102")
+			require.ErrorIs(t, err, storage.ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// BatchUpdate is one update of a batch: the changes to apply to a record, with the same
+// semantics as a single update (a null value deletes the key).
+type BatchUpdate struct {
+	ID              int                `json:"id"`
+	Data            map[string]*string `json:"data"`
+	ExpectedVersion int                `json:"expected_version,omitempty"`
+	ValidFrom       time.Time          `json:"valid_from,omitzero"`
+	ValidTo         time.Time          `json:"valid_to,omitzero"`
+	Type            string             `json:"type,omitempty"`
+	Author          string             `json:"author,omitempty"`
+	Reason          string             `json:"reason,omitempty"`
+	Source          string             `json:"source,omitempty"`
+}
+
+// BatchItemResult reports the outcome of one update of a batch, by its position in the request.
+type BatchItemResult struct {
+	Index  int               `json:"index"`
+	ID     int               `json:"id"`
+	Record *PersistentRecord `json:"record,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Fields []FieldError      `json:"fields,omitempty"`
+}
+
+// BatchResult summarizes a batch of updates.
+type BatchResult struct {
+	Atomic  bool              `json:"atomic"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemResult `json:"results"`
+	// Error is set when the batch stopped on an internal error before every update was tried.
+	Error string `json:"error,omitempty"`
+}
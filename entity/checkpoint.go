@@ -0,0 +1,26 @@
+package entity
+
+// Checkpoint is the signed Merkle root over the versions that started on a day (UTC, YYYYMMDD).
+// The Ed25519 signature covers the message "timetravel checkpoint v1\n{day}\n{leaves}\n{root}".
+// Root, Signature and PublicKey are hex encoded.
+type Checkpoint struct {
+	Day       string `json:"day"`
+	Leaves    int    `json:"leaves"`
+	Root      string `json:"root"`
+	Created   string `json:"created"`
+	Signature string `json:"signature"`
+	PublicKey string `json:"public_key"`
+}
+
+// InclusionProof proves that a version is a leaf of the Merkle tree of its day's checkpoint.
+// Leaf is the JSON array of the version's fields whose hash is the leaf; Proof lists the hex encoded
+// hashes of the sibling subtrees from the leaf up to the root (RFC 6962).
+type InclusionProof struct {
+	ID         int        `json:"id"`
+	Version    int        `json:"version"`
+	Leaf       string     `json:"leaf"`
+	LeafHash   string     `json:"leaf_hash"`
+	LeafIndex  int        `json:"leaf_index"`
+	Proof      []string   `json:"proof"`
+	Checkpoint Checkpoint `json:"checkpoint"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+// ValueChange holds the old and new value of a key that changed between two versions.
+type ValueChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// RecordDiff describes which keys were added, removed and changed between two versions of a record.
+type RecordDiff struct {
+	ID      int                    `json:"id"`
+	From    int                    `json:"from"`
+	To      int                    `json:"to"`
+	Added   map[string]string      `json:"added"`
+	Removed map[string]string      `json:"removed"`
+	Changed map[string]ValueChange `json:"changed"`
+}
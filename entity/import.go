@@ -0,0 +1,19 @@
+package entity
+
+// ImportError reports why one line of an import was rejected.
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportResult summarizes an import of versioned records. When the import stopped on an error, StoppedAt is the
+// first line that was not imported: it and every later line were not written, while the earlier lines were
+// imported unless they are reported in Errors.
+type ImportResult struct {
+	DryRun    bool          `json:"dry_run"`
+	Imported  int           `json:"imported"`
+	Failed    int           `json:"failed"`
+	Errors    []ImportError `json:"errors"`
+	StoppedAt int           `json:"stopped_at,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+// KeyInterval is a stretch of valid time during which a key had the same value, as known now.
+// Versions are the versions that give the key its value during the interval.
+type KeyInterval struct {
+	Value     string `json:"value"`
+	ValidFrom string `json:"valid_from"`
+	ValidTo   string `json:"valid_to,omitempty"`
+	Versions  []int  `json:"versions"`
+}
+
+// KeyHistory lists the values a single key of a record had, in valid time order.
+type KeyHistory struct {
+	ID        int           `json:"id"`
+	Key       string        `json:"key"`
+	Intervals []KeyInterval `json:"intervals"`
+}
@@ -0,0 +1,10 @@
+package entity
+
+// PatchOperation is one operation of an RFC 6902 JSON Patch document.
+// Value is used by add, replace and test; From by move and copy.
+type PatchOperation struct {
+	Op    string  `json:"op"`
+	Path  string  `json:"path"`
+	From  string  `json:"from,omitempty"`
+	Value *string `json:"value,omitempty"`
+}
@@ -2,12 +2,24 @@ package entity
 
 import "maps"
 
+// PersistentRecord is one version of a bitemporal record.
+// Start/End is the transaction time (when the version was recorded and superseded),
+// ValidFrom/ValidTo is the valid time (when the data was true in the real world).
+// Author/Reason/Source describe the change that produced the version.
 type PersistentRecord struct {
-	ID      int               `json:"id"`
-	Version int               `json:"version"`
-	Start   string            `json:"start"`
-	End     string            `json:"end,omitempty"`
-	Data    map[string]string `json:"data"`
+	ID            int               `json:"id"`
+	Version       int               `json:"version"`
+	Start         string            `json:"start"`
+	End           string            `json:"end,omitempty"`
+	ValidFrom     string            `json:"valid_from"`
+	ValidTo       string            `json:"valid_to,omitempty"`
+	RecordType    string            `json:"record_type,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Deleted       bool              `json:"deleted,omitempty"`
+	Author        string            `json:"author,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	Source        string            `json:"source,omitempty"`
+	Data          map[string]string `json:"data"`
 }
 
 type PersistentRecords struct {
@@ -26,11 +38,19 @@ func (d *PersistentRecords) Copy() VersionedRecord {
 
 func (d *PersistentRecord) Copy() Record {
 	return &PersistentRecord{
-		ID:      d.ID,
-		Version: d.Version,
-		Start:   d.Start,
-		End:     d.End,
-		Data:    maps.Clone(d.Data),
+		ID:            d.ID,
+		Version:       d.Version,
+		Start:         d.Start,
+		End:           d.End,
+		ValidFrom:     d.ValidFrom,
+		ValidTo:       d.ValidTo,
+		RecordType:    d.RecordType,
+		SchemaVersion: d.SchemaVersion,
+		Deleted:       d.Deleted,
+		Author:        d.Author,
+		Reason:        d.Reason,
+		Source:        d.Source,
+		Data:          maps.Clone(d.Data),
 	}
 }
 
@@ -73,3 +93,19 @@ func (d *PersistentRecord) GetEnd() string {
 func (d *PersistentRecord) SetEnd(end string) {
 	d.End = end
 }
+
+func (d *PersistentRecord) GetValidFrom() string {
+	return d.ValidFrom
+}
+
+func (d *PersistentRecord) SetValidFrom(validFrom string) {
+	d.ValidFrom = validFrom
+}
+
+func (d *PersistentRecord) GetValidTo() string {
+	return d.ValidTo
+}
+
+func (d *PersistentRecord) SetValidTo(validTo string) {
+	d.ValidTo = validTo
+}
@@ -0,0 +1,18 @@
+package entity
+
+import "encoding/json"
+
+// Schema is one version of the JSON Schema that records of a type are validated against.
+type Schema struct {
+	RecordType string          `json:"record_type"`
+	Version    int             `json:"version"`
+	Created    string          `json:"created"`
+	Schema     json.RawMessage `json:"schema"`
+}
+
+// FieldError reports why a value of a record does not match its schema.
+// Field is a JSON Pointer to the value, such as /address/city.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
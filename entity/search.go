@@ -0,0 +1,8 @@
+package entity
+
+// SearchResult is a version of a record that matched a full-text search, with the matching extract of its data.
+type SearchResult struct {
+	ID      int    `json:"id"`
+	Version int    `json:"version"`
+	Snippet string `json:"snippet"`
+}
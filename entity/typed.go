@@ -0,0 +1,69 @@
+package entity
+
+import (
+	"encoding/json"
+	"maps"
+)
+
+// TypedRecord is one version of a bitemporal record whose values are arbitrary JSON
+// (strings, numbers, booleans, arrays, nested objects), as served by v3.
+type TypedRecord struct {
+	ID            int                        `json:"id"`
+	Version       int                        `json:"version"`
+	Start         string                     `json:"start"`
+	End           string                     `json:"end,omitempty"`
+	ValidFrom     string                     `json:"valid_from"`
+	ValidTo       string                     `json:"valid_to,omitempty"`
+	RecordType    string                     `json:"record_type,omitempty"`
+	SchemaVersion int                        `json:"schema_version,omitempty"`
+	Deleted       bool                       `json:"deleted,omitempty"`
+	Author        string                     `json:"author,omitempty"`
+	Reason        string                     `json:"reason,omitempty"`
+	Source        string                     `json:"source,omitempty"`
+	Data          map[string]json.RawMessage `json:"data"`
+}
+
+type TypedRecords struct {
+	Records []TypedRecord `json:"records"`
+}
+
+func (d *TypedRecords) Copy() VersionedRecord {
+	output := TypedRecords{
+		Records: make([]TypedRecord, len(d.Records)),
+	}
+	for i, record := range d.Records {
+		output.Records[i] = *record.Copy()
+	}
+	return &output
+}
+
+// Copy returns a copy of the record; the raw values are never modified in place, so they are shared.
+func (d *TypedRecord) Copy() *TypedRecord {
+	return &TypedRecord{
+		ID:            d.ID,
+		Version:       d.Version,
+		Start:         d.Start,
+		End:           d.End,
+		ValidFrom:     d.ValidFrom,
+		ValidTo:       d.ValidTo,
+		RecordType:    d.RecordType,
+		SchemaVersion: d.SchemaVersion,
+		Deleted:       d.Deleted,
+		Author:        d.Author,
+		Reason:        d.Reason,
+		Source:        d.Source,
+		Data:          maps.Clone(d.Data),
+	}
+}
+
+func (d *TypedRecord) GetID() int {
+	return d.ID
+}
+
+func (d *TypedRecord) GetVersion() int {
+	return d.Version
+}
+
+func (d *TypedRecord) GetData() map[string]json.RawMessage {
+	return d.Data
+}
@@ -0,0 +1,12 @@
+package entity
+
+// Verification is the result of checking the hash chain of the versions of a record.
+// Hash is the hash of the latest version, which vouches for the whole history of the record.
+type Verification struct {
+	ID            int    `json:"id"`
+	Versions      int    `json:"versions"`
+	Valid         bool   `json:"valid"`
+	Hash          string `json:"hash"`
+	BrokenVersion int    `json:"broken_version,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
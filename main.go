@@ -1,22 +1,81 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/regr76/timetravel/api"
 	"github.com/regr76/timetravel/dbutils"
+	"github.com/regr76/timetravel/storage"
 )
 
-func main() {
+// openStore opens the PostgreSQL database named by DATABASE_URL, which several instances of the server may
+// share, or else the SQLite file next to the binary. With migrate, the migrations the database has not had
+// yet are applied; without, the database must already be up to date.
+func openStore(migrate bool) (*sql.DB, storage.Store, error) {
+	initPostgres, initDB := dbutils.InitPostgres, dbutils.InitDB
+	if !migrate {
+		initPostgres, initDB = dbutils.OpenPostgres, dbutils.OpenDB
+	}
+
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		log.Printf("initializing postgres database")
+		db, err := initPostgres(url)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, dbutils.NewPostgresStore(db), nil
+	}
+
 	filename := "timetravel.db"
 	log.Printf("initializing database with file %s", filename)
+	db, err := initDB(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if available, err := dbutils.SearchAvailable(db); err == nil && !available {
+		log.Printf("full-text search is unavailable: this binary was built without the sqlite_fts5 tag; build it with make")
+	}
+	return db, dbutils.NewStore(db), nil
+}
 
-	db, err := dbutils.InitDB(filename)
+func main() {
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	// tt keygen creates the key that signs checkpoints; it does not need the database
+	if command == "keygen" {
+		if err := keygen(signingKeyFile()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// the schema is upgraded on start unless MIGRATE_ON_START=false, which leaves it to tt migrate
+	migrate := os.Getenv("MIGRATE_ON_START") != "false" || command == "migrate"
+	db, store, err := openStore(migrate)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// tt migrate, tt verify and tt checkpoint run a command against the database instead of serving it
+	if command != "" {
+		err = runCommand(context.Background(), store, command)
+		if cerr := db.Close(); cerr != nil {
+			log.Printf("db close: %v", cerr)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// close and check the error
 	defer func() {
 		if cerr := db.Close(); cerr != nil {
@@ -25,7 +84,7 @@ func main() {
 	}()
 
 	app := api.NewAPI(nil, nil, db)
-	router := app.SetupRouter(db)
+	router := app.SetupRouterWithStore(store)
 
 	address := "127.0.0.1:8000"
 	srv := &http.Server{
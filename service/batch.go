@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+// batchTxSize is the number of updates written per transaction by a best-effort batch.
+const batchTxSize = 500
+
+// errBatchRolledBack is reported for the updates of an atomic batch that were undone because another update failed.
+var errBatchRolledBack = errors.New("not applied; another update of the batch failed")
+
+// errBatchStopped is reported for the updates that were undone or never tried because the batch stopped on an
+// error of the store.
+var errBatchStopped = errors.New("not applied; the batch stopped on an internal error")
+
+// UpdateRecords will apply many updates with the semantics of UpdateRecord, in the order given.
+// Every update runs in its own savepoint, so a failing update leaves no partial version behind.
+// If atomic, all updates share one transaction which is rolled back when any of them fails; otherwise
+// updates are committed in chunks and the failing ones are reported and skipped.
+// An error of the store stops the batch: it is returned along with the result, in which the updates of the
+// chunks committed before keep their outcome and every other update is reported as failed.
+func (s *PersistentRecordService) UpdateRecords(ctx context.Context, updates []entity.BatchUpdate, atomic bool) (*entity.BatchResult, error) {
+	result := &entity.BatchResult{
+		Atomic:  atomic,
+		Results: make([]entity.BatchItemResult, len(updates)),
+	}
+	for i, update := range updates {
+		result.Results[i] = entity.BatchItemResult{Index: i, ID: update.ID}
+	}
+
+	chunkSize := batchTxSize
+	if atomic {
+		chunkSize = len(updates)
+	}
+	for from := 0; from < len(updates); from += chunkSize {
+		to := min(from+chunkSize, len(updates))
+		err := s.writeBatchChunk(ctx, updates[from:to], result.Results[from:to], atomic)
+		if err != nil {
+			for i := from; i < len(updates); i++ {
+				if result.Results[i].Error == "" {
+					result.Results[i].Record = nil
+					result.Results[i].Error = errBatchStopped.Error()
+				}
+			}
+			countBatchResults(result)
+			return result, err
+		}
+	}
+
+	countBatchResults(result)
+	return result, nil
+}
+
+// countBatchResults sets the number of updated and failed updates of the result.
+func countBatchResults(result *entity.BatchResult) {
+	for _, item := range result.Results {
+		if item.Error != "" {
+			result.Failed++
+		} else {
+			result.Updated++
+		}
+	}
+}
+
+// writeBatchChunk applies a chunk of updates in one transaction, recording the outcome of each in results.
+// Only errors caused by an update itself are reported per item; any other error aborts the chunk.
+func (s *PersistentRecordService) writeBatchChunk(ctx context.Context, updates []entity.BatchUpdate, results []entity.BatchItemResult, atomic bool) error {
+	err := s.store.Update(ctx, func(tx storage.Tx) error {
+		failed := false
+		for i, update := range updates {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var record *entity.PersistentRecord
+			opts := UpdateOptions{
+				ValidFrom:  update.ValidFrom,
+				ValidTo:    update.ValidTo,
+				RecordType: update.Type,
+				Author:     update.Author,
+				Reason:     update.Reason,
+				Source:     update.Source,
+			}
+			if update.ExpectedVersion > 0 {
+				opts.ExpectedVersions = []int{update.ExpectedVersion}
+			}
+			// a conflict is undone with the savepoint and retried on the version another writer committed
+			err := retryConflicts(opts, func() error {
+				return tx.Savepoint(func() error {
+					if update.ID <= 0 {
+						return ErrRecordIDInvalid
+					}
+					row, errUpdate := appendVersionTx(tx, update.ID, opts, applyUpdates(update.Data), false)
+					if errUpdate != nil {
+						return errUpdate
+					}
+					record, errUpdate = recordFromRow(row)
+					return errUpdate
+				})
+			})
+			var validationErr *ValidationError
+			switch {
+			case errors.As(err, &validationErr):
+				results[i].Error = validationErr.Error()
+				results[i].Fields = validationErr.Fields
+				failed = true
+			case errors.Is(err, ErrVersionConflict):
+				results[i].Error = fmt.Sprintf("record of id %v is no longer at version %v", update.ID, update.ExpectedVersion)
+				failed = true
+			case errors.Is(err, ErrRecordIDInvalid), errors.Is(err, ErrValidityInvalid), errors.Is(err, ErrConcurrentUpdate),
+				errors.Is(err, ErrRecordTypeInvalid), errors.Is(err, ErrSchemaDoesNotExist):
+				results[i].Error = err.Error()
+				failed = true
+			case err != nil:
+				return err
+			default:
+				results[i].Record = record
+			}
+		}
+
+		if atomic && failed {
+			return errBatchRolledBack
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchRolledBack) {
+		for i := range results {
+			results[i].Record = nil
+			if results[i].Error == "" {
+				results[i].Error = errBatchRolledBack.Error()
+			}
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+var ErrCheckpointDoesNotExist = errors.New("day has no checkpoint")
+var ErrCheckpointMismatch = errors.New("versions of the day no longer match its checkpoint")
+
+// checkpointDayLength is the length of the YYYYMMDD prefix of a timestamp that names its day.
+const checkpointDayLength = 8
+
+// checkpointMessage is the message signed for a checkpoint.
+func checkpointMessage(day string, leaves int, root string) []byte {
+	return []byte("timetravel checkpoint v1\n" + day + "\n" + strconv.Itoa(leaves) + "\n" + root)
+}
+
+// LoadSigningKey will read the Ed25519 private key from a PKCS #8 PEM file. A missing file is an error rather
+// than a reason to sign with a new key, which auditors holding the published public key would not trust.
+func LoadSigningKey(filename string) (ed25519.PrivateKey, error) {
+	encoded, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(encoded)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM encoded private key", filename)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", filename)
+	}
+	return signingKey, nil
+}
+
+// CreateSigningKey will generate a new Ed25519 private key and write it to a PKCS #8 PEM file readable by its
+// owner only. It fails if the file exists, so a key in use is never replaced.
+func CreateSigningKey(filename string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: encoded}); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return key, file.Close()
+}
+
+// dayTree is the Merkle tree over the versions that started on a day.
+type dayTree struct {
+	rows   []storage.Row
+	leaves [][]byte
+}
+
+func (s *PersistentRecordService) readDayTree(day string) (*dayTree, error) {
+	rows, err := s.store.ReadDay(day)
+	if err != nil {
+		return nil, err
+	}
+	tree := &dayTree{rows: rows, leaves: make([][]byte, 0, len(rows))}
+	for _, row := range rows {
+		tree.leaves = append(tree.leaves, merkleLeafHash(storage.LeafData(row)))
+	}
+	return tree, nil
+}
+
+// CreateCheckpoints will compute and sign the Merkle root of every day before the given time that has versions
+// but no checkpoint yet. Days are only checkpointed once they are over, as no version can start on them anymore.
+func (s *PersistentRecordService) CreateCheckpoints(ctx context.Context, key ed25519.PrivateKey, before time.Time) ([]entity.Checkpoint, error) {
+	today := FormatTimestamp(before)[:checkpointDayLength]
+	days, err := s.store.ReadDaysWithoutCheckpoint(today)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := []entity.Checkpoint{}
+	for _, day := range days {
+		if err := ctx.Err(); err != nil {
+			return checkpoints, err
+		}
+
+		tree, err := s.readDayTree(day)
+		if err != nil {
+			return checkpoints, err
+		}
+		root := hex.EncodeToString(merkleRoot(tree.leaves))
+		row := storage.CheckpointRow{
+			Day:       day,
+			Leaves:    len(tree.leaves),
+			Root:      root,
+			Created:   FormatTimestamp(time.Now()),
+			Signature: hex.EncodeToString(ed25519.Sign(key, checkpointMessage(day, len(tree.leaves), root))),
+			PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+		}
+		if err := s.store.WriteCheckpoint(row); err != nil {
+			return checkpoints, err
+		}
+		checkpoints = append(checkpoints, checkpointFromRow(&row))
+	}
+	return checkpoints, nil
+}
+
+// GetCheckpoint will retrieve the checkpoint of a day (YYYYMMDD).
+func (s *PersistentRecordService) GetCheckpoint(ctx context.Context, day string) (*entity.Checkpoint, error) {
+	row, err := s.store.ReadCheckpoint(day)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrCheckpointDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := checkpointFromRow(row)
+	return &checkpoint, nil
+}
+
+// GetInclusionProof will prove that a version is part of the checkpoint of the day it started on.
+// The tree of the day is computed again from the stored versions; if its root is no longer the checkpointed
+// one, the versions of the day were edited and ErrCheckpointMismatch is returned.
+func (s *PersistentRecordService) GetInclusionProof(ctx context.Context, id int, version int) (*entity.InclusionProof, error) {
+	row, err := s.store.ReadVersion(id, version)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrVersionDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := s.GetCheckpoint(ctx, row.Start[:checkpointDayLength])
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := s.readDayTree(checkpoint.Day)
+	if err != nil {
+		return nil, err
+	}
+	if len(tree.leaves) != checkpoint.Leaves || hex.EncodeToString(merkleRoot(tree.leaves)) != checkpoint.Root {
+		return nil, ErrCheckpointMismatch
+	}
+
+	index := -1
+	for i, leaf := range tree.rows {
+		if leaf.ID == id && leaf.Version == version {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, ErrCheckpointMismatch
+	}
+
+	proof := []string{}
+	for _, hash := range merkleInclusionProof(index, tree.leaves) {
+		proof = append(proof, hex.EncodeToString(hash))
+	}
+	return &entity.InclusionProof{
+		ID:         id,
+		Version:    version,
+		Leaf:       string(storage.LeafData(tree.rows[index])),
+		LeafHash:   hex.EncodeToString(tree.leaves[index]),
+		LeafIndex:  index,
+		Proof:      proof,
+		Checkpoint: *checkpoint,
+	}, nil
+}
+
+func checkpointFromRow(row *storage.CheckpointRow) entity.Checkpoint {
+	return entity.Checkpoint{
+		Day:       row.Day,
+		Leaves:    row.Leaves,
+		Root:      row.Root,
+		Created:   row.Created,
+		Signature: row.Signature,
+		PublicKey: row.PublicKey,
+	}
+}
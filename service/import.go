@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"time"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+// importBatchSize is the number of versions written per transaction during an import.
+const importBatchSize = 500
+
+// importedVersion is the last version of a record, as it will be once the import has been written.
+type importedVersion struct {
+	version int
+	start   string
+	end     string
+}
+
+// errImportRewritesHistory rejects a version that would close a still open version at a moment that has
+// already been recorded as part of its transaction time.
+var errImportRewritesHistory = errors.New("starts before the import, so closing the still open previous version then would rewrite recorded history")
+
+// pendingRow is a validated version waiting to be written with its batch.
+type pendingRow struct {
+	line int
+	row  storage.Row
+	// closePrevious is set when the previous version of the record is still open; it is closed at the start
+	// of the row in the same transaction
+	closePrevious bool
+}
+
+// ImportRecords will validate and write versions replayed from another system, in the order given.
+// Every version must directly follow the previous version of its record (already stored or earlier in the import),
+// which must be closed no later than the new version starts; a previous version that is still open, such as the
+// current version of a live record, is closed when the new version starts, which must not be before the import.
+// Rejected lines are reported and skipped, so one bad line does not abort the import. When a batch cannot be
+// written the import stops, and the result up to that batch is returned with the error. With dryRun nothing is
+// written.
+func (s *PersistentRecordService) ImportRecords(ctx context.Context, lines iter.Seq2[*entity.PersistentRecord, error], dryRun bool) (*entity.ImportResult, error) {
+	result := &entity.ImportResult{
+		DryRun: dryRun,
+		Errors: []entity.ImportError{},
+	}
+	last := map[int]importedVersion{}
+	var batch []pendingRow
+
+	reject := func(line int, err error) {
+		result.Errors = append(result.Errors, entity.ImportError{Line: line, Error: err.Error()})
+	}
+	flush := func() error {
+		imported, rejected, err := s.writeImportBatch(ctx, batch)
+		if err != nil {
+			result.StoppedAt = batch[0].line
+			return err
+		}
+		result.Imported += imported
+		result.Errors = append(result.Errors, rejected...)
+		batch = batch[:0]
+		return nil
+	}
+	finish := func() {
+		// errors found while writing come after the validation errors of later lines
+		slices.SortStableFunc(result.Errors, func(a, b entity.ImportError) int {
+			return a.Line - b.Line
+		})
+		result.Failed = len(result.Errors)
+	}
+	defer finish()
+
+	line := 0
+	for record, err := range lines {
+		line++
+		if err != nil {
+			reject(line, err)
+			continue
+		}
+
+		row, closePrevious, err := s.validateImport(record, last)
+		if err != nil {
+			reject(line, err)
+			continue
+		}
+		last[row.ID] = importedVersion{version: row.Version, start: row.Start, end: row.End}
+
+		if dryRun {
+			result.Imported++
+			continue
+		}
+
+		batch = append(batch, pendingRow{line: line, row: *row, closePrevious: closePrevious})
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// validateImport checks that the record continues the history of its id and converts it into a row. It also
+// reports whether the previous version is still open and must be closed when the row is written.
+func (s *PersistentRecordService) validateImport(record *entity.PersistentRecord, last map[int]importedVersion) (*storage.Row, bool, error) {
+	if record.ID <= 0 {
+		return nil, false, ErrRecordIDInvalid
+	}
+
+	for _, timestamp := range []struct {
+		name     string
+		value    string
+		optional bool
+	}{
+		{"start", record.Start, false},
+		{"end", record.End, true},
+		{"valid_from", record.ValidFrom, true},
+		{"valid_to", record.ValidTo, true},
+	} {
+		if timestamp.value == "" && timestamp.optional {
+			continue
+		}
+		if _, err := ParseTimestamp(timestamp.value); err != nil {
+			return nil, false, fmt.Errorf("invalid %s: %w", timestamp.name, err)
+		}
+	}
+	// the versions of a checkpointed day are signed; adding to them would break the checkpoint
+	_, err := s.store.ReadCheckpoint(record.Start[:checkpointDayLength])
+	switch {
+	case err == nil:
+		return nil, false, fmt.Errorf("version %d of record %d starts on %s, which is already checkpointed", record.Version, record.ID, record.Start[:checkpointDayLength])
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, false, err
+	}
+
+	if record.End != "" && !laterMicrosecond(record.Start, record.End) {
+		return nil, false, fmt.Errorf("end %s is not after start %s", record.End, record.Start)
+	}
+
+	validFrom := record.ValidFrom
+	if validFrom == "" {
+		validFrom = record.Start
+	}
+	if record.ValidTo != "" && !laterMicrosecond(validFrom, record.ValidTo) {
+		return nil, false, ErrValidityInvalid
+	}
+
+	previous, ok := last[record.ID]
+	if !ok {
+		latest, err := s.store.ReadLatest(record.ID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, false, err
+		}
+		if latest != nil {
+			previous = importedVersion{version: latest.Version, start: latest.Start, end: latest.End}
+		}
+	}
+
+	if record.Version != previous.version+1 {
+		return nil, false, fmt.Errorf("version %d of record %d does not follow version %d", record.Version, record.ID, previous.version)
+	}
+	closePrevious := previous.version > 0 && previous.end == ""
+	if closePrevious && !laterMicrosecond(previous.start, record.Start) {
+		return nil, false, fmt.Errorf("version %d of record %d does not start after the still open version %d starts at %s", record.Version, record.ID, previous.version, previous.start)
+	}
+	if closePrevious && record.Start < FormatTimestamp(time.Now()) {
+		return nil, false, fmt.Errorf("version %d of record %d %w", record.Version, record.ID, errImportRewritesHistory)
+	}
+	if previous.version > 0 && previous.end > record.Start {
+		return nil, false, fmt.Errorf("version %d of record %d starts before version %d ends at %s", record.Version, record.ID, previous.version, previous.end)
+	}
+
+	data := record.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// typed versions must match the schema version they name, or the latest one; tombstones have no data
+	schemaVersion := 0
+	if record.RecordType != "" && !record.Deleted {
+		schemaVersion, err = validateRecordData(s.store, record.RecordType, record.SchemaVersion, encodedData)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return &storage.Row{
+		ID:            record.ID,
+		Version:       record.Version,
+		Start:         record.Start,
+		End:           record.End,
+		ValidFrom:     validFrom,
+		ValidTo:       record.ValidTo,
+		Data:          encodedData,
+		RecordType:    record.RecordType,
+		SchemaVersion: schemaVersion,
+		Deleted:       record.Deleted,
+		Author:        record.Author,
+		Reason:        record.Reason,
+		Source:        record.Source,
+	}, closePrevious, nil
+}
+
+// writeImportBatch writes a batch of validated versions in one transaction, each in its own savepoint. A version
+// that can no longer be written, because the record was updated concurrently since it was validated, its stored
+// history does not match its hashes or the import has reached its start, is rejected on its own.
+func (s *PersistentRecordService) writeImportBatch(ctx context.Context, batch []pendingRow) (int, []entity.ImportError, error) {
+	var imported int
+	var rejected []entity.ImportError
+
+	err := s.store.Update(ctx, func(tx storage.Tx) error {
+		imported, rejected = 0, nil
+		for _, pending := range batch {
+			err := tx.Savepoint(func() error {
+				return s.writeImportedVersion(tx, pending)
+			})
+			reason := ""
+			switch {
+			case errors.Is(err, storage.ErrVersionConflict):
+				reason = fmt.Sprintf("version %d of record %d: %v", pending.row.Version, pending.row.ID, ErrVersionConflict)
+			case errors.Is(err, storage.ErrHashMismatch):
+				reason = fmt.Sprintf("version %d of record %d: %v", pending.row.Version, pending.row.ID, err)
+			case errors.Is(err, errImportRewritesHistory):
+				reason = fmt.Sprintf("version %d of record %d %v", pending.row.Version, pending.row.ID, err)
+			case err != nil:
+				return err
+			default:
+				imported++
+				continue
+			}
+			rejected = append(rejected, entity.ImportError{Line: pending.line, Error: reason})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return imported, rejected, nil
+}
+
+// writeImportedVersion appends a validated version, first closing the previous version at its start when that
+// version was still open. Versions are only closed while they are the latest, so a record updated since it was
+// validated is a conflict, and only from now on, so a batch written after the start of one of its versions has
+// passed rejects that version.
+func (s *PersistentRecordService) writeImportedVersion(tx storage.Tx, pending pendingRow) error {
+	row := pending.row
+	if pending.closePrevious {
+		if row.Start < FormatTimestamp(time.Now()) {
+			return errImportRewritesHistory
+		}
+		latest, err := tx.ReadLatest(row.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return storage.ErrVersionConflict
+		}
+		if err != nil {
+			return err
+		}
+		if latest.Version != row.Version-1 || latest.End != "" {
+			return storage.ErrVersionConflict
+		}
+		if err := tx.CloseVersion(row.ID, latest.Version, row.Start); err != nil {
+			return err
+		}
+	}
+	return tx.Append(row)
+}
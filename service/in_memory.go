@@ -11,6 +11,10 @@ var ErrRecordDoesNotExist = errors.New("record with that id does not exist")
 var ErrRecordIDInvalid = errors.New("record id must >= 0")
 var ErrRecordAlreadyExists = errors.New("record already exists")
 var ErrVersionDoesNotExist = errors.New("record with that version does not exist")
+var ErrValidityInvalid = errors.New("valid_to must be after valid_from")
+var ErrVersionConflict = errors.New("record is no longer at the expected version")
+var ErrConcurrentUpdate = errors.New("record is being updated concurrently; try again")
+var ErrRecordDeleted = errors.New("record with that id has been deleted")
 
 // InMemoryRecordService is an in-memory implementation of RecordService.
 type InMemoryRecordService struct {
@@ -2,6 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"iter"
+	"time"
 
 	"github.com/regr76/timetravel/entity"
 )
@@ -24,14 +28,145 @@ type RecordService interface {
 	UpdateRecord(ctx context.Context, id int, updates map[string]*string) (entity.Record, error)
 }
 
+// UpdateOptions controls how a new version of a versioned record is written.
+type UpdateOptions struct {
+	// ValidFrom is the start of the valid time of the new version; defaults to the time of the write.
+	ValidFrom time.Time
+	// ValidTo is the end of the valid time of the new version; zero means until the next change in the valid
+	// time of the record, open-ended if there is none.
+	ValidTo time.Time
+	// ExpectedVersions are the versions of which GetRecord must return one for the update to be applied;
+	// empty means any.
+	ExpectedVersions []int
+	// MustExist requires GetRecord to return the record, at whatever version, for the update to be applied.
+	MustExist bool
+	// RecordType sets the type of the record, whose latest schema the new version must match;
+	// empty keeps the type of the previous version.
+	RecordType string
+	// Author, Reason and Source describe the change: who made it, why, and from which system.
+	Author string
+	Reason string
+	Source string
+}
+
+// ExportFilter restricts the versions exported by ExportRecords; zero values do not filter.
+type ExportFilter struct {
+	// FromID and ToID are the inclusive id range of the exported records.
+	FromID int
+	ToID   int
+	// Since and Until select the versions that were current at some point in [Since, Until).
+	Since time.Time
+	Until time.Time
+}
+
+// Implements method to get, create, and update bitemporal record data.
 type VersionedRecordService interface {
-	RecordService
+
+	// GetRecord will retrieve the version of a record valid now, as known now, which plain updates build on.
+	GetRecord(ctx context.Context, id int) (entity.Record, error)
+
+	// CreateRecord will insert a new record (first version), valid from the time of the write.
+	CreateRecord(ctx context.Context, record entity.Record) error
+
+	// UpdateRecord will close the latest version and add a new version with the updates applied
+	// to the data known to be valid at opts.ValidFrom.
+	// if the update[key] is null it will delete that key from the record's Map.
+	//
+	// UpdateRecord will fail with ErrVersionConflict if the record does not meet opts.ExpectedVersions or opts.MustExist,
+	// and with a *ValidationError if the record has a type and the new data does not match its schema.
+	UpdateRecord(ctx context.Context, id int, updates map[string]*string, opts UpdateOptions) (entity.Record, error)
+
+	// UpdateRecords will apply many updates, either all or nothing (atomic) or best-effort, reporting each outcome.
+	UpdateRecords(ctx context.Context, updates []entity.BatchUpdate, atomic bool) (*entity.BatchResult, error)
+
+	// PatchRecord will add a new version with the RFC 6902 JSON Patch operations applied to the data known to be
+	// valid at opts.ValidFrom. It fails with ErrPatchInvalid for malformed operations and ErrPatchFailed
+	// (for example a failed test) without writing anything.
+	PatchRecord(ctx context.Context, id int, operations []entity.PatchOperation, opts UpdateOptions) (entity.Record, error)
+
+	// MergeRecord will add a new version with the RFC 7396 JSON Merge Patch applied to the data known to be valid at
+	// opts.ValidFrom. Unlike UpdateRecord, values need not be strings: objects are merged into the values they patch.
+	MergeRecord(ctx context.Context, id int, patch map[string]json.RawMessage, opts UpdateOptions) (entity.Record, error)
+
+	// DeleteRecord will add a tombstone version closing the record; GetRecord then fails with ErrRecordDeleted
+	// while the history stays available. Posting a new version undeletes the record.
+	// Only the expected versions, opts.MustExist and the valid time apply to the tombstone.
+	DeleteRecord(ctx context.Context, id int, opts UpdateOptions) (entity.Record, error)
+
+	// RevertRecord will add a new version whose data equals the data of the given historical version.
+	RevertRecord(ctx context.Context, id int, version int, opts UpdateOptions) (entity.Record, error)
+
 	GetVersion(ctx context.Context, id int, version int) (entity.Record, error)
+
+	// GetRecordAt will retrieve the version of the record that was current at the given time.
+	GetRecordAt(ctx context.Context, id int, at time.Time) (entity.Record, error)
+
+	// GetRecordAsOf will retrieve the version that, as known at knownAt, was valid at validAt.
+	GetRecordAsOf(ctx context.Context, id int, knownAt time.Time, validAt time.Time) (entity.Record, error)
+
+	// Snapshot will call fn for every record with the version that was current at the given time.
+	Snapshot(ctx context.Context, at time.Time, fn func(record *entity.PersistentRecord) error) error
+
+	// FindRecords will call fn for every record whose version current at the given time has all the values of where.
+	FindRecords(ctx context.Context, where map[string]string, at time.Time, fn func(record *entity.PersistentRecord) error) error
+
+	// SearchRecords will return the versions whose data matches the full-text query; a zero at searches every version.
+	SearchRecords(ctx context.Context, query string, at time.Time, limit int) ([]entity.SearchResult, error)
+
+	// DiffVersions will compare the data of two versions of a record.
+	DiffVersions(ctx context.Context, id int, from int, to int) (*entity.RecordDiff, error)
+
 	ListRecords(ctx context.Context, id int) (entity.VersionedRecord, error)
-	ExportAllRecords(ctx context.Context) ([]string, error)
+
+	// KeyHistory will list the values a key had over the history of a record, collapsing unchanged versions.
+	KeyHistory(ctx context.Context, id int, key string) (*entity.KeyHistory, error)
+
+	// VerifyRecord will check the hash chain of the versions of a record.
+	VerifyRecord(ctx context.Context, id int) (*entity.Verification, error)
+
+	// VerifyRecords will check the hash chain of every record, calling fn with the result for each record.
+	VerifyRecords(ctx context.Context, fn func(verification *entity.Verification) error) error
+
+	// CreateCheckpoints will sign the Merkle root of every past day with versions that has no checkpoint yet.
+	CreateCheckpoints(ctx context.Context, key ed25519.PrivateKey, before time.Time) ([]entity.Checkpoint, error)
+
+	// GetCheckpoint will retrieve the checkpoint of a day.
+	GetCheckpoint(ctx context.Context, day string) (*entity.Checkpoint, error)
+
+	// GetInclusionProof will prove that a version is part of the checkpoint of its day.
+	GetInclusionProof(ctx context.Context, id int, version int) (*entity.InclusionProof, error)
+
+	// ImportRecords will validate and write versions replayed from another system, reporting rejected lines.
+	ImportRecords(ctx context.Context, lines iter.Seq2[*entity.PersistentRecord, error], dryRun bool) (*entity.ImportResult, error)
+
+	// RegisterSchema will store the schema as the next version of the JSON Schema of the record type.
+	RegisterSchema(ctx context.Context, recordType string, schema json.RawMessage) (*entity.Schema, error)
+
+	// GetSchema will retrieve a version of the schema of a record type (the latest if version is 0).
+	GetSchema(ctx context.Context, recordType string, version int) (*entity.Schema, error)
+
+	// ExportRecords will call fn for every version of every record matching the filter.
+	ExportRecords(ctx context.Context, filter ExportFilter, fn func(record *entity.PersistentRecord) error) error
+}
+
+// Implements method to get and update bitemporal records whose values are arbitrary JSON.
+// Records are shared with VersionedRecordService, which serves non-string values as their JSON text.
+type TypedRecordService interface {
+
+	// GetRecord will retrieve the version of a record valid now; it fails with ErrRecordDeleted for deleted records.
+	GetRecord(ctx context.Context, id int) (*entity.TypedRecord, error)
+
+	GetVersion(ctx context.Context, id int, version int) (*entity.TypedRecord, error)
+
+	ListRecords(ctx context.Context, id int) (*entity.TypedRecords, error)
+
+	// UpdateRecord will close the latest version and add a new version with the updates applied.
+	// Every update replaces the value of its key; if the update[key] is null it will delete that key.
+	UpdateRecord(ctx context.Context, id int, updates map[string]json.RawMessage, opts UpdateOptions) (*entity.TypedRecord, error)
 }
 
 type Storage interface {
 	InMemRecords() RecordService
 	PersistentRecords() VersionedRecordService
+	TypedRecords() TypedRecordService
 }
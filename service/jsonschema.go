@@ -0,0 +1,307 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/regr76/timetravel/entity"
+)
+
+// jsonSchema is a compiled JSON Schema. The validation keywords of draft 2020-12 that describe
+// the shape of plain data are supported: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength, pattern, minimum,
+// maximum, exclusiveMinimum and exclusiveMaximum. Annotations are ignored; any other keyword is refused,
+// so that no schema appears to promise a rule that is not enforced.
+type jsonSchema struct {
+	reject bool // the schema false, which no value matches
+
+	types                []string
+	enum                 []any
+	constValue           any
+	hasConst             bool
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	items                *jsonSchema
+	minItems             *int
+	maxItems             *int
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+}
+
+// jsonSchemaAnnotations are the keywords that describe a schema without constraining the data.
+var jsonSchemaAnnotations = []string{"$schema", "$id", "$comment", "title", "description", "default", "examples", "deprecated", "readOnly", "writeOnly"}
+
+var jsonSchemaTypes = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// compiledSchemas caches compiled schemas by their text; stored schema versions never change.
+var compiledSchemas sync.Map
+
+// compileJSONSchema parses and checks a schema document.
+func compileJSONSchema(raw []byte) (*jsonSchema, error) {
+	if cached, ok := compiledSchemas.Load(string(raw)); ok {
+		return cached.(*jsonSchema), nil
+	}
+
+	var document any
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	schema, err := compileSchemaValue(document, "")
+	if err != nil {
+		return nil, err
+	}
+
+	compiledSchemas.Store(string(raw), schema)
+	return schema, nil
+}
+
+func compileSchemaValue(document any, path string) (*jsonSchema, error) {
+	schema := &jsonSchema{}
+	switch value := document.(type) {
+	case bool:
+		schema.reject = !value
+		return schema, nil
+	case map[string]any:
+		for keyword, argument := range value {
+			if err := schema.compileKeyword(keyword, argument, path); err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", path, keyword, err)
+			}
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", path)
+	}
+}
+
+func (s *jsonSchema) compileKeyword(keyword string, argument any, path string) error {
+	var err error
+	switch keyword {
+	case "type":
+		s.types, err = compileTypes(argument)
+	case "enum":
+		values, ok := argument.([]any)
+		if !ok {
+			return errors.New("must be an array")
+		}
+		s.enum = values
+	case "const":
+		s.constValue, s.hasConst = argument, true
+	case "properties":
+		properties, ok := argument.(map[string]any)
+		if !ok {
+			return errors.New("must be an object")
+		}
+		s.properties = make(map[string]*jsonSchema, len(properties))
+		for name, property := range properties {
+			s.properties[name], err = compileSchemaValue(property, path+"/properties/"+escapePointer(name))
+			if err != nil {
+				return err
+			}
+		}
+	case "required":
+		names, ok := argument.([]any)
+		if !ok {
+			return errors.New("must be an array of strings")
+		}
+		for _, name := range names {
+			text, ok := name.(string)
+			if !ok {
+				return errors.New("must be an array of strings")
+			}
+			s.required = append(s.required, text)
+		}
+	case "additionalProperties":
+		s.additionalProperties, err = compileSchemaValue(argument, path+"/additionalProperties")
+	case "items":
+		s.items, err = compileSchemaValue(argument, path+"/items")
+	case "minItems":
+		s.minItems, err = compileCount(argument)
+	case "maxItems":
+		s.maxItems, err = compileCount(argument)
+	case "minLength":
+		s.minLength, err = compileCount(argument)
+	case "maxLength":
+		s.maxLength, err = compileCount(argument)
+	case "pattern":
+		text, ok := argument.(string)
+		if !ok {
+			return errors.New("must be a string")
+		}
+		s.pattern, err = regexp.Compile(text)
+	case "minimum":
+		s.minimum, err = compileNumber(argument)
+	case "maximum":
+		s.maximum, err = compileNumber(argument)
+	case "exclusiveMinimum":
+		s.exclusiveMinimum, err = compileNumber(argument)
+	case "exclusiveMaximum":
+		s.exclusiveMaximum, err = compileNumber(argument)
+	default:
+		if !slices.Contains(jsonSchemaAnnotations, keyword) {
+			return errors.New("keyword is not supported")
+		}
+	}
+	return err
+}
+
+func compileTypes(argument any) ([]string, error) {
+	var names []any
+	switch value := argument.(type) {
+	case string:
+		names = []any{value}
+	case []any:
+		names = value
+	default:
+		return nil, errors.New("must be a string or an array of strings")
+	}
+
+	types := make([]string, 0, len(names))
+	for _, name := range names {
+		text, ok := name.(string)
+		if !ok || !slices.Contains(jsonSchemaTypes, text) {
+			return nil, fmt.Errorf("unknown type %v", name)
+		}
+		types = append(types, text)
+	}
+	return types, nil
+}
+
+func compileCount(argument any) (*int, error) {
+	number, ok := argument.(float64)
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, errors.New("must be a non-negative integer")
+	}
+	count := int(number)
+	return &count, nil
+}
+
+func compileNumber(argument any) (*float64, error) {
+	number, ok := argument.(float64)
+	if !ok {
+		return nil, errors.New("must be a number")
+	}
+	return &number, nil
+}
+
+// validate appends an error for every part of value that does not match the schema.
+// path is the JSON Pointer of value within the validated record.
+func (s *jsonSchema) validate(value any, path string, errs *[]entity.FieldError) {
+	report := func(format string, args ...any) {
+		*errs = append(*errs, entity.FieldError{Field: path, Error: fmt.Sprintf(format, args...)})
+	}
+
+	if s.reject {
+		report("is not allowed")
+		return
+	}
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(name string) bool { return hasJSONType(value, name) }) {
+		report("must be of type %s", strings.Join(s.types, " or "))
+		return
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(allowed any) bool { return reflect.DeepEqual(allowed, value) }) {
+		report("must be one of the allowed values")
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constValue, value) {
+		report("must be equal to the constant value")
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := typed[name]; !ok {
+				*errs = append(*errs, entity.FieldError{Field: path + "/" + escapePointer(name), Error: "is required"})
+			}
+		}
+		// report the properties in a stable order
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			property, ok := s.properties[name]
+			if !ok {
+				property = s.additionalProperties
+			}
+			if property != nil {
+				property.validate(typed[name], path+"/"+escapePointer(name), errs)
+			}
+		}
+
+	case []any:
+		if s.minItems != nil && len(typed) < *s.minItems {
+			report("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(typed) > *s.maxItems {
+			report("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range typed {
+				s.items.validate(item, fmt.Sprintf("%s/%d", path, i), errs)
+			}
+		}
+
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if s.minLength != nil && length < *s.minLength {
+			report("must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			report("must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(typed) {
+			report("must match pattern %s", s.pattern.String())
+		}
+
+	case float64:
+		if s.minimum != nil && typed < *s.minimum {
+			report("must be at least %v", *s.minimum)
+		}
+		if s.maximum != nil && typed > *s.maximum {
+			report("must be at most %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && typed <= *s.exclusiveMinimum {
+			report("must be greater than %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && typed >= *s.exclusiveMaximum {
+			report("must be less than %v", *s.exclusiveMaximum)
+		}
+	}
+}
+
+func hasJSONType(value any, name string) bool {
+	switch typed := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case map[string]any:
+		return name == "object"
+	case []any:
+		return name == "array"
+	case string:
+		return name == "string"
+	case float64:
+		return name == "number" || (name == "integer" && typed == math.Trunc(typed))
+	}
+	return false
+}
+
+// escapePointer escapes a property name for use in a JSON Pointer.
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/regr76/timetravel/entity"
+)
+
+func Test_JSONSchema_Validate(t *testing.T) {
+	schema, err := compileJSONSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "Company",
+		"type": "object",
+		"required": ["name", "employees"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 10, "description": "Legal name", "examples": ["Acme"]},
+			"employees": {"type": "integer", "minimum": 0},
+			"state": {"enum": ["CA", "NY"]},
+			"zip": {"type": "string", "pattern": "^[0-9]{5}$"},
+			"limits": {"type": "array", "items": {"type": "number", "exclusiveMinimum": 0}, "maxItems": 2},
+			"address": {"type": "object", "properties": {"a/b": {"const": "x"}}, "additionalProperties": false}
+		},
+		"additionalProperties": {"type": ["string", "null"]}
+	}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		data        string
+		want        []entity.FieldError
+	}{
+		{
+			description: "Matching data",
+			data:        `{"name":"Acme","employees":12,"state":"CA","zip":"94105","limits":[1.5,2],"address":{"a/b":"x"},"note":null}`,
+		},
+		{
+			description: "Missing required fields",
+			data:        `{}`,
+			want: []entity.FieldError{
+				{Field: "/name", Error: "is required"},
+				{Field: "/employees", Error: "is required"},
+			},
+		},
+		{
+			description: "Every keyword failing",
+			data:        `{"name":"","employees":1.5,"state":"TX","zip":"9410","limits":[0,1,2],"address":{"a/b":"y","c":1},"note":3}`,
+			want: []entity.FieldError{
+				{Field: "/address/a~1b", Error: "must be equal to the constant value"},
+				{Field: "/address/c", Error: "is not allowed"},
+				{Field: "/employees", Error: "must be of type integer"},
+				{Field: "/limits", Error: "must have at most 2 items"},
+				{Field: "/limits/0", Error: "must be greater than 0"},
+				{Field: "/name", Error: "must be at least 1 characters long"},
+				{Field: "/note", Error: "must be of type string or null"},
+				{Field: "/state", Error: "must be one of the allowed values"},
+				{Field: "/zip", Error: "must match pattern ^[0-9]{5}$"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var value any
+			require.NoError(t, json.Unmarshal([]byte(tc.data), &value))
+
+			var fields []entity.FieldError
+			schema.validate(value, "", &fields)
+			require.Equal(t, tc.want, fields)
+		})
+	}
+}
+
+func Test_JSONSchema_Compile_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		`"object"`,
+		`{"type": "decimal"}`,
+		`{"minLength": -1}`,
+		`{"pattern": "("}`,
+		`{"properties": {"a": 1}}`,
+		`{"required": [1]}`,
+		`{"$ref": "#/$defs/limit"}`,
+		`{"allOf": [{"type": "string"}]}`,
+		`{"anyOf": [{"type": "string"}]}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"not": {"type": "string"}}`,
+		`{"if": {"type": "string"}, "then": {"minLength": 1}}`,
+		`{"type": "string", "format": "email"}`,
+		`{"patternProperties": {"^a": {"type": "string"}}}`,
+		`{"multipleOf": 2}`,
+		`{"uniqueItems": true}`,
+		`{"minProperties": 1}`,
+		`{"dependentRequired": {"a": ["b"]}}`,
+		`{"properties": {"a": {"format": "date"}}}`,
+		`{"additionalProperties": {"maxProperties": 1}}`,
+	} {
+		_, err := compileJSONSchema([]byte(raw))
+		require.Error(t, err, raw)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// The Merkle trees of the checkpoints follow RFC 6962 (section 2.1): leaves and interior nodes are hashed
+// with different prefixes, so a leaf can never be passed off as a node, and a tree of n leaves is split
+// after the largest power of two smaller than n.
+
+func merkleLeafHash(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0}, data...))
+	return sum[:]
+}
+
+func merkleNodeHash(left []byte, right []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte{1})
+	hasher.Write(left)
+	hasher.Write(right)
+	return hasher.Sum(nil)
+}
+
+// merkleSplit returns the largest power of two smaller than n, for n > 1.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleRoot returns the root of the tree over the leaf hashes; the tree of no leaves has the hash of nothing.
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// merkleInclusionProof returns the audit path of the leaf at index m: the hashes of the sibling subtrees
+// from the leaf up to the root.
+func merkleInclusionProof(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return [][]byte{}
+	}
+	k := merkleSplit(len(leaves))
+	if m < k {
+		return append(merkleInclusionProof(m, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(merkleInclusionProof(m-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+// verifyMerkleInclusion checks an audit path as an auditor would (RFC 9162, section 2.1.3.2).
+func verifyMerkleInclusion(leafHash []byte, index int, size int, proof [][]byte, root []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	hash := leafHash
+	for _, sibling := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn%2 == 1 || fn == sn {
+			hash = merkleNodeHash(sibling, hash)
+			for fn%2 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = merkleNodeHash(hash, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(hash, root)
+}
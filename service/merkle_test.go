@@ -0,0 +1,37 @@
+package service
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MerkleInclusionProof(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		leaves := make([][]byte, size)
+		for i := range leaves {
+			leaves[i] = merkleLeafHash([]byte(strconv.Itoa(i)))
+		}
+		root := merkleRoot(leaves)
+
+		for index := range leaves {
+			proof := merkleInclusionProof(index, leaves)
+			require.True(t, verifyMerkleInclusion(leaves[index], index, size, proof, root), "size %d index %d", size, index)
+
+			// the proof of one leaf does not prove another
+			other := merkleLeafHash([]byte("other"))
+			require.False(t, verifyMerkleInclusion(other, index, size, proof, root))
+			if size > 1 {
+				require.False(t, verifyMerkleInclusion(leaves[index], (index+1)%size, size, proof, root))
+			}
+		}
+	}
+}
+
+func Test_MerkleRoot_RFC6962(t *testing.T) {
+	// the empty tree and the tree of one empty leaf, as in the RFC 6962 test vectors
+	require.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hex.EncodeToString(merkleRoot(nil)))
+	require.Equal(t, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d", hex.EncodeToString(merkleRoot([][]byte{merkleLeafHash(nil)})))
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/regr76/timetravel/entity"
+)
+
+// ErrPatchInvalid is returned for a JSON Patch document that is malformed.
+var ErrPatchInvalid = errors.New("invalid json patch")
+
+// ErrPatchFailed is returned when a JSON Patch operation cannot be applied, such as a failed test.
+var ErrPatchFailed = errors.New("json patch could not be applied")
+
+// PatchRecord will update End of last version, and add a new record with incremented version whose data is
+// the base version's data with the RFC 6902 JSON Patch operations applied in order. The patch is applied as a whole
+// or not at all. Records hold string values at the top level, so paths address a single key (/limit) and
+// values are strings; test compares against the value as returned by GetRecord.
+func (s *PersistentRecordService) PatchRecord(ctx context.Context, id int, operations []entity.PatchOperation, opts UpdateOptions) (entity.Record, error) {
+	for i, operation := range operations {
+		if err := checkPatchOperation(operation); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrPatchInvalid, i, err)
+		}
+	}
+
+	row, err := appendVersion(ctx, s.store, id, opts, func(newData map[string]json.RawMessage) error {
+		for i, operation := range operations {
+			if err := applyPatchOperation(newData, operation); err != nil {
+				return fmt.Errorf("%w: operation %d: %v", ErrPatchFailed, i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordFromRow(row)
+}
+
+// MergeRecord will update End of last version, and add a new record with incremented version whose data is the
+// base version's data with the RFC 7396 JSON Merge Patch applied: null deletes a key, an object is merged into the
+// value of its key, recursively, and any other value, string or not, replaces the value of its key.
+func (s *PersistentRecordService) MergeRecord(ctx context.Context, id int, patch map[string]json.RawMessage, opts UpdateOptions) (entity.Record, error) {
+	row, err := appendVersion(ctx, s.store, id, opts, func(newData map[string]json.RawMessage) error {
+		for key, value := range patch {
+			merged, err := mergePatch(newData[key], value)
+			if err != nil {
+				return err
+			}
+			if merged == nil {
+				delete(newData, key)
+			} else {
+				newData[key] = merged
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordFromRow(row)
+}
+
+// mergePatch applies a merge patch to a target value, either of which may be missing (nil). It returns nil when
+// the patch removes the value.
+func mergePatch(target json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
+	if !isJSONObject(patch) {
+		if string(bytes.TrimSpace(patch)) == "null" {
+			return nil, nil
+		}
+		return patch, nil
+	}
+
+	var patchObject map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &patchObject); err != nil {
+		return nil, err
+	}
+	targetObject := map[string]json.RawMessage{}
+	if isJSONObject(target) {
+		if err := json.Unmarshal(target, &targetObject); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range patchObject {
+		merged, err := mergePatch(targetObject[key], value)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = merged
+		}
+	}
+	return json.Marshal(targetObject)
+}
+
+func isJSONObject(value json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(value)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// checkPatchOperation checks that an operation is well formed before anything is applied.
+func checkPatchOperation(operation entity.PatchOperation) error {
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return fmt.Errorf("%s needs a string value", operation.Op)
+		}
+	case "move", "copy":
+		if _, err := patchKey(operation.From); err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unknown op %q", operation.Op)
+	}
+
+	_, err := patchKey(operation.Path)
+	return err
+}
+
+func applyPatchOperation(data map[string]json.RawMessage, operation entity.PatchOperation) error {
+	key, _ := patchKey(operation.Path)
+	current, exists := data[key]
+
+	switch operation.Op {
+	case "add":
+		return setPatchValue(data, key, *operation.Value)
+
+	case "remove":
+		if !exists {
+			return fmt.Errorf("path %s does not exist", operation.Path)
+		}
+		delete(data, key)
+
+	case "replace":
+		if !exists {
+			return fmt.Errorf("path %s does not exist", operation.Path)
+		}
+		return setPatchValue(data, key, *operation.Value)
+
+	case "move", "copy":
+		fromKey, _ := patchKey(operation.From)
+		value, ok := data[fromKey]
+		if !ok {
+			return fmt.Errorf("from %s does not exist", operation.From)
+		}
+		if operation.Op == "move" {
+			delete(data, fromKey)
+		}
+		data[key] = value
+
+	case "test":
+		if !exists {
+			return fmt.Errorf("path %s does not exist", operation.Path)
+		}
+		if text := stringValue(current); text != *operation.Value {
+			return fmt.Errorf("test failed; %s is %q, not %q", operation.Path, text, *operation.Value)
+		}
+	}
+	return nil
+}
+
+func setPatchValue(data map[string]json.RawMessage, key string, value string) error {
+	encodedValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	data[key] = encodedValue
+	return nil
+}
+
+// patchKey returns the key addressed by a JSON Pointer to a top-level value of a record.
+func patchKey(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("path %q must start with /", path)
+	}
+	token := path[1:]
+	if strings.Contains(token, "/") {
+		return "", fmt.Errorf("path %q must address a key of the record", path)
+	}
+	for i := 0; i < len(token); i++ {
+		if token[i] == '~' && (i+1 == len(token) || (token[i+1] != '0' && token[i+1] != '1')) {
+			return "", fmt.Errorf("path %q has an invalid escape", path)
+		}
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(token), nil
+}
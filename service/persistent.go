@@ -2,87 +2,335 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"time"
 
-	"github.com/regr76/timetravel/dbutils"
 	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
 )
 
-const PersistentTimeFormat = "20060102150405" // use a consistent time format for start and end times of records
+// snapshotPageSize is the number of versions read from the store at once while streaming a snapshot or export.
+const snapshotPageSize = 500
 
-// PersistentRecordService is an in-memory implementation of RecordService.
+// versionConflictRetries is the number of times a write without an expected version is tried while other
+// writers keep adding versions of the record first.
+const versionConflictRetries = 10
+
+// ErrDataKeyInvalid is returned by FindRecords for a key of where that cannot be looked up in the data.
+var ErrDataKeyInvalid = storage.ErrDataKeyInvalid
+
+// PersistentRecordService is an implementation of VersionedRecordService on a versioned store.
 type PersistentRecordService struct {
-	db *sql.DB
+	store storage.Store
 }
 
-func NewPersistentRecordService(db *sql.DB) PersistentRecordService {
+func NewPersistentRecordService(store storage.Store) PersistentRecordService {
 	return PersistentRecordService{
-		db: db,
+		store: store,
 	}
 }
 
-// GetRecord will retrieve record with latest version.
+// GetRecord will retrieve the version of the record valid now, as known now: the version plain updates build on
+// and whose version If-Match names. A retroactive correction is returned only where its valid time covers now.
 func (s *PersistentRecordService) GetRecord(ctx context.Context, id int) (entity.Record, error) {
-	recordStr, err := dbutils.ReadLatestVersion(s.db, id)
+	row, err := readCurrent(s.store, id, FormatTimestamp(time.Now()))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrRecordDoesNotExist
+	}
 	if err != nil {
 		return nil, err
 	}
-	if recordStr == "" {
+
+	if row.Deleted {
+		return nil, ErrRecordDeleted
+	}
+
+	return recordFromRow(row)
+}
+
+func (s *PersistentRecordService) GetVersion(ctx context.Context, id int, version int) (entity.Record, error) {
+	row, err := s.store.ReadVersion(id, version)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrVersionDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return recordFromRow(row)
+}
+
+// GetRecordAt will retrieve the version of the record that was current at the given time.
+func (s *PersistentRecordService) GetRecordAt(ctx context.Context, id int, at time.Time) (entity.Record, error) {
+	row, err := s.store.ReadAt(id, FormatTimestamp(at))
+	if errors.Is(err, storage.ErrNotFound) {
 		return nil, ErrRecordDoesNotExist
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if row.Deleted {
+		return nil, ErrRecordDeleted
+	}
 
-	// unmarshal data from json string to map[string]string
-	output := &entity.PersistentRecord{}
-	errUnMar := json.Unmarshal([]byte(recordStr), output)
-	if errUnMar != nil {
-		return nil, errUnMar
+	return recordFromRow(row)
+}
+
+// GetRecordAsOf will retrieve the version that, as known at knownAt, was valid at validAt.
+func (s *PersistentRecordService) GetRecordAsOf(ctx context.Context, id int, knownAt time.Time, validAt time.Time) (entity.Record, error) {
+	row, err := s.store.ReadAsOf(
+		id,
+		FormatTimestamp(knownAt),
+		FormatTimestamp(validAt),
+	)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrRecordDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if row.Deleted {
+		return nil, ErrRecordDeleted
+	}
+
+	return recordFromRow(row)
+}
+
+// Snapshot will call fn for every record, in ascending id order, with the version that was current at the given time.
+// Records are read page by page, so memory stays flat however large the database is. Since history is append-only,
+// versions current at a past instant never change, which keeps the pages consistent with each other; a time in the
+// future is therefore clamped to now.
+func (s *PersistentRecordService) Snapshot(ctx context.Context, at time.Time, fn func(record *entity.PersistentRecord) error) error {
+	return s.readVersionsAt(ctx, at, nil, fn)
+}
+
+// FindRecords will call fn, in ascending id order, for every record whose version current at the given time
+// (now if at is zero) has all the values of where. Values are compared with the values of v2, as strings.
+func (s *PersistentRecordService) FindRecords(ctx context.Context, where map[string]string, at time.Time, fn func(record *entity.PersistentRecord) error) error {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	keys := slices.Sorted(maps.Keys(where))
+	filters := make([]storage.DataFilter, 0, len(keys))
+	for _, key := range keys {
+		filters = append(filters, storage.DataFilter{Key: key, Value: where[key]})
+	}
+
+	return s.readVersionsAt(ctx, at, filters, fn)
+}
+
+// readVersionsAt pages through the versions current at the given time that match the filters.
+func (s *PersistentRecordService) readVersionsAt(ctx context.Context, at time.Time, filters []storage.DataFilter, fn func(record *entity.PersistentRecord) error) error {
+	if now := time.Now(); at.After(now) {
+		at = now
+	}
+
+	afterID := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rows, err := s.store.ScanCurrent(FormatTimestamp(at), filters, afterID, snapshotPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			record, errRow := recordFromRow(&row)
+			if errRow != nil {
+				return errRow
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+			afterID = row.ID
+		}
+
+		if len(rows) < snapshotPageSize {
+			return nil
+		}
+	}
+}
+
+// DiffVersions will compare the data of two versions of a record.
+func (s *PersistentRecordService) DiffVersions(ctx context.Context, id int, from int, to int) (*entity.RecordDiff, error) {
+	fromRecord, err := s.GetVersion(ctx, id, from)
+	if err != nil {
+		return nil, err
+	}
+	toRecord, err := s.GetVersion(ctx, id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &entity.RecordDiff{
+		ID:      id,
+		From:    from,
+		To:      to,
+		Added:   map[string]string{},
+		Removed: map[string]string{},
+		Changed: map[string]entity.ValueChange{},
+	}
+	oldData := fromRecord.GetData()
+	newData := toRecord.GetData()
+	for key, oldValue := range oldData {
+		newValue, ok := newData[key]
+		if !ok {
+			output.Removed[key] = oldValue
+		} else if newValue != oldValue {
+			output.Changed[key] = entity.ValueChange{Old: oldValue, New: newValue}
+		}
+	}
+	for key, newValue := range newData {
+		if _, ok := oldData[key]; !ok {
+			output.Added[key] = newValue
+		}
 	}
 
 	return output, nil
 }
 
-func (s *PersistentRecordService) GetVersion(ctx context.Context, id int, version int) (entity.Record, error) {
-	recordStr, err := dbutils.ReadOneVersion(s.db, id, version)
+// KeyHistory will list the values a key had over the valid time of a record, as known now, so a retroactive
+// correction shows at the time it is valid rather than at the time it was recorded. Adjacent stretches with the
+// same value are collapsed into one interval; versions without the key, such as tombstones, end the interval.
+func (s *PersistentRecordService) KeyHistory(ctx context.Context, id int, key string) (*entity.KeyHistory, error) {
+	rows, err := s.store.ReadRange(id, 1, 0)
 	if err != nil {
 		return nil, err
 	}
-	if recordStr == "" {
+	if len(rows) == 0 {
 		return nil, ErrRecordDoesNotExist
 	}
 
-	// unmarshal data from json string to map[string]string
-	output := &entity.PersistentRecord{}
-	errUnMar := json.Unmarshal([]byte(recordStr), output)
-	if errUnMar != nil {
-		return nil, errUnMar
+	// the valid time is cut at every valid_from and valid_to; within a piece the value is the one of the
+	// version covering it
+	points := validPoints(rows)
+
+	output := &entity.KeyHistory{
+		ID:        id,
+		Key:       key,
+		Intervals: []entity.KeyInterval{},
+	}
+	var current *entity.KeyInterval
+	for i, from := range points {
+		to := ""
+		if i+1 < len(points) {
+			to = points[i+1]
+		}
+
+		covering := coveringRow(rows, from)
+		value, ok := "", false
+		if covering != nil {
+			record, errRow := recordFromRow(covering)
+			if errRow != nil {
+				return nil, errRow
+			}
+			value, ok = record.Data[key]
+		}
+
+		if current != nil && (!ok || value != current.Value) {
+			output.Intervals = append(output.Intervals, *current)
+			current = nil
+		}
+		if !ok {
+			continue
+		}
+		if current == nil {
+			current = &entity.KeyInterval{Value: value, ValidFrom: from}
+		}
+		current.ValidTo = to
+		if !slices.Contains(current.Versions, covering.Version) {
+			current.Versions = append(current.Versions, covering.Version)
+			slices.Sort(current.Versions)
+		}
+	}
+	if current != nil {
+		output.Intervals = append(output.Intervals, *current)
 	}
 
 	return output, nil
 }
 
+// validPoints returns, in ascending order, the instants at which the valid time of the versions is cut:
+// every valid_from and valid_to.
+func validPoints(rows []storage.Row) []string {
+	var points []string
+	for _, row := range rows {
+		points = append(points, row.ValidFrom)
+		if row.ValidTo != "" {
+			points = append(points, row.ValidTo)
+		}
+	}
+	slices.Sort(points)
+	return slices.Compact(points)
+}
+
+// coveringRow returns the latest recorded of the versions whose valid time covers the instant, or nil if none
+// does. Given every version of a record, it is the version GetRecordAsOf answers with known_at now.
+func coveringRow(rows []storage.Row, at string) *storage.Row {
+	var covering *storage.Row
+	for i := range rows {
+		if rows[i].ValidFrom <= at && (rows[i].ValidTo == "" || rows[i].ValidTo > at) {
+			covering = &rows[i]
+		}
+	}
+	return covering
+}
+
+// nextValidChange returns the first instant after validFrom at which another version than the one valid at
+// validFrom becomes valid, as known now, or "" if there is none.
+func nextValidChange(rows []storage.Row, validFrom string) string {
+	covering := coveringRow(rows, validFrom)
+	for _, point := range validPoints(rows) {
+		if point > validFrom && coveringRow(rows, point) != covering {
+			return point
+		}
+	}
+	return ""
+}
+
+// readCurrent reads the version of the record valid now, as known now, falling back to the latest recorded
+// version when none is valid now. It fails with storage.ErrNotFound if the record has no versions.
+func readCurrent(r storage.Reader, id int, now string) (*storage.Row, error) {
+	latest, err := r.ReadLatest(id)
+	if err != nil {
+		return nil, err
+	}
+	// a version written within the same instant may start a few nanoseconds ahead of the clock
+	now = max(now, latest.Start)
+	row, err := r.ReadAsOf(id, now, now)
+	if errors.Is(err, storage.ErrNotFound) {
+		return latest, nil
+	}
+	return row, err
+}
+
 // ListRecords will retrieve record containing all versions.
 func (s *PersistentRecordService) ListRecords(ctx context.Context, id int) (entity.VersionedRecord, error) {
-	recordsStr, err := dbutils.ReadAllVersions(s.db, id)
+	rows, err := s.store.ReadRange(id, 1, 0)
 
 	if err != nil {
 		return nil, err
 	}
-	if len(recordsStr) == 0 {
+	if len(rows) == 0 {
 		return nil, ErrRecordDoesNotExist
 	}
 
-	// unmarshal data from json string to map[string]string
 	output := &entity.PersistentRecords{}
-	for _, recordStr := range recordsStr {
-		var record entity.PersistentRecord
-		errUnMar := json.Unmarshal([]byte(recordStr), &record)
-		if errUnMar != nil {
-			return nil, errUnMar
+	for _, row := range rows {
+		record, errRow := recordFromRow(&row)
+		if errRow != nil {
+			return nil, errRow
 		}
-		output.Records = append(output.Records, record)
+		output.Records = append(output.Records, *record)
 	}
 
 	return output.Copy(), nil
@@ -95,91 +343,278 @@ func (s *PersistentRecordService) CreateRecord(ctx context.Context, record entit
 		return ErrRecordIDInvalid
 	}
 
-	formattedData := `{}`
 	data := record.GetData()
-	if data != nil {
-		formattedData = `{`
-		for key, value := range data {
-			formattedData += fmt.Sprintf(`"%s":"%s",`, key, value)
+	if data == nil {
+		data = map[string]string{}
+	}
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	recordType, schemaVersion := "", 0
+	if typed, ok := record.(*entity.PersistentRecord); ok && typed.RecordType != "" {
+		recordType = typed.RecordType
+		schemaVersion, err = validateRecordData(s.store, recordType, 0, encodedData)
+		if err != nil {
+			return err
 		}
-		formattedData = formattedData[:len(formattedData)-1] + `}` // remove trailing comma and add closing bracket
 	}
 
-	return dbutils.WriteVersion(s.db, id, 1, time.Now().UTC().Format(PersistentTimeFormat), "", formattedData)
+	start := FormatTimestamp(time.Now())
+	err = s.store.Append(storage.Row{
+		ID:            id,
+		Version:       1,
+		Start:         start,
+		ValidFrom:     start,
+		Data:          encodedData,
+		RecordType:    recordType,
+		SchemaVersion: schemaVersion,
+	})
+	if errors.Is(err, storage.ErrVersionConflict) {
+		return ErrRecordAlreadyExists
+	}
+	return err
 }
 
 // UpdateRecord will update End of last version, and add a new record with incremented version.
-func (s *PersistentRecordService) UpdateRecord(ctx context.Context, id int, updates map[string]*string) (entity.Record, error) {
+// The updates are applied to the data that, as known now, was valid at opts.ValidFrom.
+func (s *PersistentRecordService) UpdateRecord(ctx context.Context, id int, updates map[string]*string, opts UpdateOptions) (entity.Record, error) {
+	row, err := appendVersion(ctx, s.store, id, opts, applyUpdates(updates))
+	if err != nil {
+		return nil, err
+	}
+
+	return recordFromRow(row)
+}
+
+// applyUpdates returns the apply function of an update: a nil value deletes the key, any other value sets it.
+func applyUpdates(updates map[string]*string) func(newData map[string]json.RawMessage) error {
+	return func(newData map[string]json.RawMessage) error {
+		for key, value := range updates {
+			if value == nil { // deletion update
+				delete(newData, key)
+				continue
+			}
+
+			encodedValue, err := json.Marshal(*value)
+			if err != nil {
+				return err
+			}
+			newData[key] = encodedValue
+		}
+		return nil
+	}
+}
+
+// RevertRecord will update End of last version, and add a new record with incremented version
+// whose data equals the data of the given historical version.
+func (s *PersistentRecordService) RevertRecord(ctx context.Context, id int, version int, opts UpdateOptions) (entity.Record, error) {
+	target, err := s.store.ReadVersion(id, version)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrVersionDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the stored values are copied as they are, so typed values are not turned into strings
+	targetData, err := decodeData(target.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := appendVersion(ctx, s.store, id, opts, func(newData map[string]json.RawMessage) error {
+		clear(newData)
+		maps.Copy(newData, targetData)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordFromRow(row)
+}
+
+// appendVersion closes the last version of the record and writes a new version
+// whose data is the base version's data modified by apply.
+// The read, close and insert happen in a single transaction, so a failure leaves the history untouched.
+func appendVersion(ctx context.Context, store storage.Store, id int, opts UpdateOptions, apply func(newData map[string]json.RawMessage) error) (*storage.Row, error) {
+	var newVersion *storage.Row
+	err := retryConflicts(opts, func() error {
+		return store.Update(ctx, func(tx storage.Tx) error {
+			var errTx error
+			newVersion, errTx = appendVersionTx(tx, id, opts, apply, false)
+			return errTx
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newVersion, nil
+}
+
+// errLostRace is the ErrVersionConflict of a write that lost to another writer, such as another instance sharing
+// the store, which added a version first.
+var errLostRace = fmt.Errorf("%w: another writer added a version first", ErrVersionConflict)
+
+// retryConflicts runs write, which appends a version of a record, again while it fails with errLostRace. Without
+// expected versions the write then simply applies on top of the version of the other writer; with them, the
+// conflict is the answer. A write that keeps losing fails with ErrConcurrentUpdate.
+func retryConflicts(opts UpdateOptions, write func() error) error {
+	err := write()
+	if len(opts.ExpectedVersions) > 0 {
+		return err
+	}
+	for attempt := 1; errors.Is(err, errLostRace); attempt++ {
+		if attempt == versionConflictRetries {
+			return ErrConcurrentUpdate
+		}
+		err = write()
+	}
+	return err
+}
+
+// appendVersionTx is appendVersion on an already open transaction.
+// The data is handled as raw JSON values, so string and typed values are carried over unchanged.
+// Without opts.ValidTo the new version is valid until the next change in the valid time of the record, so a
+// retroactive correction does not hide the versions that became valid after it.
+// If deleted, the new version is a tombstone with empty data and apply is not called;
+// a later version brings the record back starting from that empty data.
+func appendVersionTx(tx storage.Tx, id int, opts UpdateOptions, apply func(newData map[string]json.RawMessage) error, deleted bool) (*storage.Row, error) {
 	var version int
-	copyOfLastVersion := &entity.PersistentRecord{}
 	// first retrieve the record to see if an existing version exists
-	recordStr, err := dbutils.ReadLatestVersion(s.db, id)
+	lastRow, err := tx.ReadLatest(id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
 
-	if recordStr == "" || err != nil { // record does not exist, create new record with version 1
-		version = 1
-	} else { // record exists, need to update the End time of the last version and add a new version with updated data
+	previousStart := ""
+	if lastRow != nil {
+		previousStart = lastRow.Start
+	}
+	nextStart, err := nextTimestamp(previousStart)
+	if err != nil {
+		return nil, err
+	}
+	now := FormatTimestamp(nextStart)
 
-		// unmarshal data from json string to map[string]string
-		errUnMar := json.Unmarshal([]byte(recordStr), copyOfLastVersion)
-		if errUnMar != nil {
-			return nil, errUnMar
+	validFrom := now
+	if !opts.ValidFrom.IsZero() {
+		validFrom = FormatTimestamp(opts.ValidFrom)
+	}
+	validTo := ""
+	if !opts.ValidTo.IsZero() {
+		validTo = FormatTimestamp(opts.ValidTo)
+		if !laterMicrosecond(validFrom, validTo) {
+			return nil, ErrValidityInvalid
 		}
+	}
 
-		version = copyOfLastVersion.Version
+	if deleted && lastRow == nil {
+		return nil, ErrRecordDoesNotExist
+	}
+
+	// the version valid now is the one GetRecord returns and If-Match names; the version valid at validFrom
+	// is the base of the new version, falling back to the last version when nothing was valid at that time
+	var rows []storage.Row
+	current, base := lastRow, lastRow
+	if lastRow != nil {
+		rows, err = tx.ReadRange(id, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		if covering := coveringRow(rows, now); covering != nil {
+			current = covering
+		}
+		if covering := coveringRow(rows, validFrom); covering != nil {
+			base = covering
+		}
+		if validTo == "" {
+			validTo = nextValidChange(rows, validFrom)
+		}
+	}
+	if deleted && current.Deleted {
+		return nil, ErrRecordDeleted
+	}
 
-		copyOfLastVersion.End = time.Now().UTC().Format(PersistentTimeFormat) // set end time for last version
+	baseData := []byte(`{}`)
+	if lastRow == nil { // record does not exist, create new record with version 1
+		if len(opts.ExpectedVersions) > 0 || opts.MustExist {
+			return nil, ErrVersionConflict
+		}
+		version = 1
+	} else { // record exists, need to update the End time of the last version and add a new version with updated data
+		version = lastRow.Version
+		if len(opts.ExpectedVersions) > 0 && !slices.Contains(opts.ExpectedVersions, current.Version) {
+			return nil, ErrVersionConflict
+		}
+		if opts.MustExist && current.Deleted {
+			return nil, ErrVersionConflict
+		}
 
-		errWr := dbutils.UpdateVersion(
-			s.db,
-			copyOfLastVersion.GetID(),
-			version,
-			copyOfLastVersion.End,
-		)
+		// set end time for last version, which always is after its start
+		errWr := tx.CloseVersion(id, version, now)
+		if errors.Is(errWr, storage.ErrVersionConflict) {
+			return nil, errLostRace
+		}
 		if errWr != nil {
 			return nil, errWr
 		}
 
+		baseData = base.Data
+
 		version += 1 // increment version for the new version to be created
 	}
 
 	// now create the new version with updated data
-	newData := copyOfLastVersion.Copy().(*entity.PersistentRecord).GetData() // copy data from last version for the new version
-	if newData == nil {
-		newData = map[string]string{}
-	}
-	for key, value := range updates {
-		if value == nil { // deletion update
-			delete(newData, key)
-		} else {
-			if value != nil {
-				newData[key] = *value
-			}
-		}
+	newData, err := decodeData(baseData)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		clear(newData)
+	} else if err := apply(newData); err != nil {
+		return nil, err
 	}
 
-	formattedData := `{}`
-	if newData != nil || len(newData) > 0 {
-		formattedData = `{`
-		for key, value := range newData {
-			formattedData += fmt.Sprintf(`"%s":"%s",`, key, value)
+	encodedData, err := json.Marshal(newData)
+	if err != nil {
+		return nil, err
+	}
+
+	// a record with a type must match the schema of that type in force now
+	recordType := opts.RecordType
+	if recordType == "" && lastRow != nil {
+		recordType = lastRow.RecordType
+	}
+	schemaVersion := 0
+	if recordType != "" && !deleted {
+		schemaVersion, err = validateRecordData(tx, recordType, 0, encodedData)
+		if err != nil {
+			return nil, err
 		}
-		formattedData = formattedData[:len(formattedData)-1] + `}` // remove trailing comma and add closing bracket
 	}
-	newVersion := &entity.PersistentRecord{
-		ID:      id,
-		Version: version,
-		Start:   time.Now().UTC().Format(PersistentTimeFormat),
-		End:     "",
-		Data:    newData,
-	}
-	errWr := dbutils.WriteVersion(
-		s.db,
-		newVersion.GetID(),
-		newVersion.Version,
-		newVersion.Start,
-		newVersion.End,
-		formattedData,
-	)
+
+	newVersion := &storage.Row{
+		ID:            id,
+		Version:       version,
+		Start:         now,
+		End:           "",
+		ValidFrom:     validFrom,
+		ValidTo:       validTo,
+		Data:          encodedData,
+		RecordType:    recordType,
+		SchemaVersion: schemaVersion,
+		Deleted:       deleted,
+		Author:        opts.Author,
+		Reason:        opts.Reason,
+		Source:        opts.Source,
+	}
+	errWr := tx.Append(*newVersion)
+	if errors.Is(errWr, storage.ErrVersionConflict) {
+		return nil, errLostRace
+	}
 	if errWr != nil {
 		return nil, errWr
 	}
@@ -187,10 +622,115 @@ func (s *PersistentRecordService) UpdateRecord(ctx context.Context, id int, upda
 	return newVersion, nil
 }
 
-func (s *PersistentRecordService) ExportAllRecords(ctx context.Context) ([]string, error) {
-	recordsStr, err := dbutils.ReadAllRows(s.db)
+// DeleteRecord will close the latest version with a tombstone version, after which GetRecord fails with
+// ErrRecordDeleted. The history stays available, and a later update brings the record back.
+func (s *PersistentRecordService) DeleteRecord(ctx context.Context, id int, opts UpdateOptions) (entity.Record, error) {
+	var row *storage.Row
+	err := retryConflicts(opts, func() error {
+		return s.store.Update(ctx, func(tx storage.Tx) error {
+			var errTx error
+			row, errTx = appendVersionTx(tx, id, opts, nil, true)
+			return errTx
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordFromRow(row)
+}
+
+// ExportRecords will call fn for every version of every record matching the filter, in ascending (id, version) order.
+// Versions are read page by page using the last exported (id, version) as cursor, so memory stays flat.
+func (s *PersistentRecordService) ExportRecords(ctx context.Context, filter ExportFilter, fn func(record *entity.PersistentRecord) error) error {
+	rowFilter := storage.RowFilter{
+		FromID: filter.FromID,
+		ToID:   filter.ToID,
+	}
+	if !filter.Since.IsZero() {
+		rowFilter.Since = FormatTimestamp(filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		rowFilter.Until = FormatTimestamp(filter.Until)
+	}
+
+	afterID, afterVersion := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rows, err := s.store.Scan(rowFilter, afterID, afterVersion, snapshotPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			record, errRow := recordFromRow(&row)
+			if errRow != nil {
+				return errRow
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+			afterID, afterVersion = row.ID, row.Version
+		}
+
+		if len(rows) < snapshotPageSize {
+			return nil
+		}
+	}
+}
+
+// recordFromRow decodes the stored JSON data of a row into a record with string values.
+// Values that are not strings (written through v3) are returned as their JSON text.
+func recordFromRow(row *storage.Row) (*entity.PersistentRecord, error) {
+	output := &entity.PersistentRecord{
+		ID:            row.ID,
+		Version:       row.Version,
+		Start:         row.Start,
+		End:           row.End,
+		ValidFrom:     row.ValidFrom,
+		ValidTo:       row.ValidTo,
+		RecordType:    row.RecordType,
+		SchemaVersion: row.SchemaVersion,
+		Deleted:       row.Deleted,
+		Author:        row.Author,
+		Reason:        row.Reason,
+		Source:        row.Source,
+	}
+	data, err := decodeData(row.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	output.Data = make(map[string]string, len(data))
+	for key, value := range data {
+		output.Data[key] = stringValue(value)
+	}
+
+	return output, nil
+}
+
+// stringValue returns a stored value as a string: strings as they are, other values as their JSON text.
+func stringValue(value json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return string(value)
+	}
+	return text
+}
+
+// decodeData decodes the stored JSON object of a row into its raw values.
+func decodeData(data []byte) (map[string]json.RawMessage, error) {
+	var output map[string]json.RawMessage
+	err := json.Unmarshal(data, &output)
 	if err != nil {
 		return nil, err
 	}
-	return recordsStr, nil
+	if output == nil {
+		output = map[string]json.RawMessage{}
+	}
+
+	return output, nil
 }
@@ -0,0 +1,630 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/regr76/timetravel/dbutils"
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+func Test_UpdateRecord_FailedInsertKeepsHistory(t *testing.T) {
+	ctx := context.Background()
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	s := NewPersistentRecordService(dbutils.NewStore(db))
+
+	value := "1"
+	_, err = s.UpdateRecord(ctx, 7, map[string]*string{"a": &value}, UpdateOptions{})
+	require.NoError(t, err)
+
+	// inject a failure after the previous version has been closed
+	_, err = db.Exec(`CREATE TRIGGER inject_failure BEFORE INSERT ON records BEGIN SELECT RAISE(ABORT, 'injected failure'); END`)
+	require.NoError(t, err)
+
+	value = "2"
+	_, err = s.UpdateRecord(ctx, 7, map[string]*string{"a": &value}, UpdateOptions{})
+	require.ErrorContains(t, err, "injected failure")
+
+	record, err := s.GetRecord(ctx, 7)
+	require.NoError(t, err)
+	latest := record.(*entity.PersistentRecord)
+	require.Equal(t, 1, latest.Version)
+	require.Equal(t, "", latest.End)
+	require.Equal(t, map[string]string{"a": "1"}, latest.Data)
+}
+
+func FuzzRecordRoundTrip(f *testing.F) {
+	ctx := context.Background()
+	db, err := dbutils.InitDB(filepath.Join(f.TempDir(), "unit-test.db"))
+	require.NoError(f, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	s := NewPersistentRecordService(dbutils.NewStore(db))
+
+	f.Add("key", "value")
+	f.Add(`quo"te`, `back\slash`)
+	f.Add("new\nline", "tab\tand\r\n")
+	f.Add("", "")
+	f.Add("ünïcødé 🔑", "日本語の値 \u0000  ")
+	f.Add(`{"nested":"json"}`, `","injected":"`)
+
+	id := 0
+	f.Fuzz(func(t *testing.T, key string, value string) {
+		if !utf8.ValidString(key) || !utf8.ValidString(value) {
+			t.Skip("json strings are utf-8")
+		}
+		id++
+
+		// created records and updated records take different write paths
+		err := s.CreateRecord(ctx, &entity.PersistentRecord{ID: id, Data: map[string]string{key: value}})
+		require.NoError(t, err)
+		record, err := s.GetRecord(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{key: value}, record.GetData())
+
+		updated := value + value
+		_, err = s.UpdateRecord(ctx, id, map[string]*string{key: &updated, "other": &value}, UpdateOptions{})
+		require.NoError(t, err)
+		record, err = s.GetRecord(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{key: updated, "other": value}, record.GetData())
+
+		records, err := s.ListRecords(ctx, id)
+		require.NoError(t, err)
+		require.Len(t, records.(*entity.PersistentRecords).Records, 2)
+	})
+}
+
+func Test_UpdateRecord_MonotonicStart(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewPersistentRecordService(store)
+
+			// a version recorded while the clock was an hour ahead, before it stepped back
+			ahead := FormatTimestamp(time.Now().Add(time.Hour))
+			err := store.Append(storage.Row{ID: 8, Version: 1, Start: ahead, ValidFrom: ahead, Data: []byte(`{}`)})
+			require.NoError(t, err)
+
+			// several updates within the clock resolution
+			for i := 0; i < 20; i++ {
+				value := strconv.Itoa(i)
+				_, err = s.UpdateRecord(ctx, 8, map[string]*string{"a": &value}, UpdateOptions{})
+				require.NoError(t, err)
+			}
+
+			records, err := s.ListRecords(ctx, 8)
+			require.NoError(t, err)
+			versions := records.(*entity.PersistentRecords).Records
+			require.Len(t, versions, 21)
+			for i, version := range versions {
+				if i > 0 {
+					require.Greater(t, version.Start, versions[i-1].Start)
+				}
+				if version.End != "" {
+					require.Greater(t, version.End, version.Start)
+					require.Equal(t, versions[i+1].Start, version.End)
+				}
+			}
+		})
+	}
+}
+
+func Test_ParseTimestamp(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	require.Equal(t, "20260301120000123456789", FormatTimestamp(at))
+
+	parsed, err := ParseTimestamp(FormatTimestamp(at))
+	require.NoError(t, err)
+	require.True(t, at.Equal(parsed))
+
+	_, err = ParseTimestamp("20260301120000")
+	require.Error(t, err)
+}
+
+func Test_Snapshot_Pages(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewPersistentRecordService(store)
+
+			// more records than fit on one page, each with a closed and an open version
+			total := 2*snapshotPageSize + 7
+			writeTwoVersions(t, store, total, `{"v":"1"}`, `{"v":"2"}`)
+
+			var ids []int
+			err := s.Snapshot(ctx, time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), func(record *entity.PersistentRecord) error {
+				require.Equal(t, 1, record.Version)
+				require.Equal(t, map[string]string{"v": "1"}, record.Data)
+				ids = append(ids, record.ID)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Len(t, ids, total)
+			require.Equal(t, total, ids[len(ids)-1])
+		})
+	}
+}
+
+func Test_ExportRecords_Filters(t *testing.T) {
+	ctx := context.Background()
+	// versions 1 (January) and 2 (February onwards) of more records than fit on one page
+	total := snapshotPageSize + 3
+
+	tests := []struct {
+		description string
+		filter      ExportFilter
+		wantCount   int
+	}{
+		{
+			description: "No filter",
+			wantCount:   2 * total,
+		},
+		{
+			description: "Id range",
+			filter:      ExportFilter{FromID: 10, ToID: 19},
+			wantCount:   20,
+		},
+		{
+			description: "Versions current in January",
+			filter:      ExportFilter{Since: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), Until: time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)},
+			wantCount:   total,
+		},
+		{
+			description: "Versions current across the update",
+			filter:      ExportFilter{FromID: 1, ToID: 1, Since: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), Until: time.Date(2026, 2, 20, 0, 0, 0, 0, time.UTC)},
+			wantCount:   2,
+		},
+	}
+
+	for name, store := range testStores(t) {
+		s := NewPersistentRecordService(store)
+		writeTwoVersions(t, store, total, `{}`, `{}`)
+
+		for _, tc := range tests {
+			t.Run(name+"/"+tc.description, func(t *testing.T) {
+				count := 0
+				lastID, lastVersion := 0, 0
+				err := s.ExportRecords(ctx, tc.filter, func(record *entity.PersistentRecord) error {
+					require.True(t, record.ID > lastID || (record.ID == lastID && record.Version > lastVersion))
+					lastID, lastVersion = record.ID, record.Version
+					count++
+					return nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, tc.wantCount, count)
+			})
+		}
+	}
+}
+
+// testStores returns a store of each kind for the tests that run against every store.
+func testStores(t *testing.T) map[string]storage.Store {
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return map[string]storage.Store{
+		"sqlite": dbutils.NewStore(db),
+		"memory": storage.NewMemoryStore(),
+	}
+}
+
+// writeTwoVersions writes records 1 to total, each with a version current in January 2026 and one current since.
+func writeTwoVersions(t *testing.T, store storage.Store, total int, january string, february string) {
+	for id := 1; id <= total; id++ {
+		err := store.Append(storage.Row{ID: id, Version: 1, Start: "20260101000000000000000", End: "20260201000000000000000", ValidFrom: "20260101000000000000000", Data: []byte(january)})
+		require.NoError(t, err)
+		err = store.Append(storage.Row{ID: id, Version: 2, Start: "20260201000000000000000", ValidFrom: "20260201000000000000000", Data: []byte(february)})
+		require.NoError(t, err)
+	}
+}
+
+// failingStore is a store whose transactions fail from the failFrom-th on, as when the disk fills up.
+type failingStore struct {
+	storage.Store
+	failFrom int
+	updates  int
+}
+
+var errStoreFailed = errors.New("disk full")
+
+func (s *failingStore) Update(ctx context.Context, fn func(tx storage.Tx) error) error {
+	s.updates++
+	if s.updates >= s.failFrom {
+		return errStoreFailed
+	}
+	return s.Store.Update(ctx, fn)
+}
+
+func Test_UpdateRecords_ReportsCommittedChunksOnFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStore{Store: storage.NewMemoryStore(), failFrom: 2}
+	s := NewPersistentRecordService(store)
+
+	value := "1"
+	updates := make([]entity.BatchUpdate, batchTxSize+2)
+	for i := range updates {
+		updates[i] = entity.BatchUpdate{ID: i + 1, Data: map[string]*string{"a": &value}}
+	}
+	updates[1].ValidTo = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the first chunk is committed before the second fails
+	result, err := s.UpdateRecords(ctx, updates, false)
+	require.ErrorIs(t, err, errStoreFailed)
+	require.Equal(t, batchTxSize-1, result.Updated)
+	require.Equal(t, 3, result.Failed)
+	require.NotNil(t, result.Results[0].Record)
+	require.Equal(t, ErrValidityInvalid.Error(), result.Results[1].Error)
+	for _, item := range result.Results[batchTxSize:] {
+		require.Nil(t, item.Record)
+		require.Equal(t, errBatchStopped.Error(), item.Error)
+	}
+	_, err = store.ReadLatest(batchTxSize)
+	require.NoError(t, err)
+	_, err = store.ReadLatest(batchTxSize + 1)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func Test_ImportRecords_ReportsCommittedBatchesOnFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStore{Store: storage.NewMemoryStore(), failFrom: 2}
+	s := NewPersistentRecordService(store)
+
+	// the first batch is committed before the second fails
+	result, err := s.ImportRecords(ctx, func(yield func(*entity.PersistentRecord, error) bool) {
+		for id := 1; id <= importBatchSize+2; id++ {
+			record := &entity.PersistentRecord{ID: id, Version: 1, Start: "20200101000000000000000", Data: map[string]string{}}
+			if id == 2 {
+				record.Version = 2
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}, false)
+	require.ErrorIs(t, err, errStoreFailed)
+	require.Equal(t, importBatchSize, result.Imported)
+	require.Equal(t, importBatchSize+2, result.StoppedAt)
+	require.Equal(t, []entity.ImportError{{Line: 2, Error: "version 2 of record 2 does not follow version 0"}}, result.Errors)
+	_, err = store.ReadLatest(importBatchSize + 1)
+	require.NoError(t, err)
+	_, err = store.ReadLatest(importBatchSize + 2)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func Test_NextTimestamp_StartsInLaterMicrosecond(t *testing.T) {
+	// several writes within a microsecond, or a clock that stepped backwards
+	future := time.Now().UTC().Add(time.Hour)
+	previous := FormatTimestamp(future.Truncate(time.Microsecond).Add(999 * time.Nanosecond))
+	next, err := nextTimestamp(previous)
+	require.NoError(t, err)
+	require.Equal(t, future.Truncate(time.Microsecond).Add(time.Microsecond), next)
+	require.True(t, laterMicrosecond(previous, FormatTimestamp(next)))
+
+	// the clock has moved on
+	previous = FormatTimestamp(time.Now().UTC().Add(-time.Hour))
+	next, err = nextTimestamp(previous)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), next, time.Minute)
+}
+
+// racingStore is a store on which another writer appends a version first, making Append fail, the next races times.
+type racingStore struct {
+	storage.Store
+	races int
+}
+
+func (s *racingStore) Update(ctx context.Context, fn func(tx storage.Tx) error) error {
+	return s.Store.Update(ctx, func(tx storage.Tx) error {
+		return fn(racingTx{Tx: tx, store: s})
+	})
+}
+
+type racingTx struct {
+	storage.Tx
+	store *racingStore
+}
+
+func (tx racingTx) Append(row storage.Row) error {
+	if tx.store.races > 0 {
+		tx.store.races--
+		return storage.ErrVersionConflict
+	}
+	return tx.Tx.Append(row)
+}
+
+func Test_UpdateRecord_RetriesLostRaces(t *testing.T) {
+	ctx := context.Background()
+	store := &racingStore{Store: storage.NewMemoryStore()}
+	s := NewPersistentRecordService(store)
+	value := "1"
+
+	// without an expected version the update is applied on top of the versions of other writers
+	store.races = 3
+	record, err := s.UpdateRecord(ctx, 1, map[string]*string{"a": &value}, UpdateOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, record.(*entity.PersistentRecord).Version)
+	store.races = 2
+	result, err := s.UpdateRecords(ctx, []entity.BatchUpdate{{ID: 1, Data: map[string]*string{"b": &value}}}, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Updated)
+	store.races = 1
+	_, err = s.DeleteRecord(ctx, 1, UpdateOptions{})
+	require.NoError(t, err)
+
+	// with one the conflict is the answer
+	store.races = 1
+	_, err = s.UpdateRecord(ctx, 1, map[string]*string{"a": &value}, UpdateOptions{ExpectedVersions: []int{3}})
+	require.ErrorIs(t, err, ErrVersionConflict)
+
+	// a write that keeps losing gives up
+	store.races = versionConflictRetries
+	_, err = s.UpdateRecord(ctx, 1, map[string]*string{"a": &value}, UpdateOptions{})
+	require.ErrorIs(t, err, ErrConcurrentUpdate)
+	store.races = 0
+	record, err = s.UpdateRecord(ctx, 1, map[string]*string{"a": &value}, UpdateOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 4, record.(*entity.PersistentRecord).Version)
+}
+
+func Test_GetRecord_ReturnsVersionValidNow(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewPersistentRecordService(store)
+			value := "100"
+			_, err := s.UpdateRecord(ctx, 1, map[string]*string{"employees": &value}, UpdateOptions{})
+			require.NoError(t, err)
+			value = "90"
+			january := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			_, err = s.UpdateRecord(ctx, 1, map[string]*string{"employees": &value}, UpdateOptions{ValidFrom: january, ValidTo: january.AddDate(0, 1, 0)})
+			require.NoError(t, err)
+
+			// the correction is no longer valid, so the first version is returned and updates build on it
+			record, err := s.GetRecord(ctx, 1)
+			require.NoError(t, err)
+			require.Equal(t, 1, record.(*entity.PersistentRecord).Version)
+			require.Equal(t, map[string]string{"employees": "100"}, record.(*entity.PersistentRecord).Data)
+
+			value = "CA"
+			record, err = s.UpdateRecord(ctx, 1, map[string]*string{"state": &value}, UpdateOptions{ExpectedVersions: []int{1}})
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"employees": "100", "state": "CA"}, record.(*entity.PersistentRecord).Data)
+			_, err = s.UpdateRecord(ctx, 1, map[string]*string{"state": &value}, UpdateOptions{ExpectedVersions: []int{2}})
+			require.ErrorIs(t, err, ErrVersionConflict)
+
+			// snapshots and where still read the versions current in transaction time
+			var versions []int
+			err = s.Snapshot(ctx, time.Now(), func(record *entity.PersistentRecord) error {
+				versions = append(versions, record.Version)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []int{3}, versions)
+		})
+	}
+}
+
+func Test_RetroactiveCorrection_KeepsLaterChanges(t *testing.T) {
+	ctx := context.Background()
+	january := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	march := january.AddDate(0, 2, 0)
+	april := january.AddDate(0, 3, 0)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewPersistentRecordService(store)
+			count, state := "100", "CA"
+			_, err := s.UpdateRecord(ctx, 1, map[string]*string{"count": &count, "state": &state}, UpdateOptions{ValidFrom: january})
+			require.NoError(t, err)
+			state = "NV"
+			_, err = s.UpdateRecord(ctx, 1, map[string]*string{"state": &state}, UpdateOptions{ValidFrom: march})
+			require.NoError(t, err)
+
+			// an open-ended correction from January ends where the March change starts
+			count = "120"
+			record, err := s.UpdateRecord(ctx, 1, map[string]*string{"count": &count}, UpdateOptions{ValidFrom: january})
+			require.NoError(t, err)
+			require.Equal(t, FormatTimestamp(march), record.(*entity.PersistentRecord).ValidTo)
+			require.Equal(t, map[string]string{"count": "120", "state": "CA"}, record.(*entity.PersistentRecord).Data)
+
+			now := time.Now()
+			record, err = s.GetRecordAsOf(ctx, 1, now, january.AddDate(0, 0, 14))
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"count": "120", "state": "CA"}, record.(*entity.PersistentRecord).Data)
+			record, err = s.GetRecordAsOf(ctx, 1, now, april)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"count": "100", "state": "NV"}, record.(*entity.PersistentRecord).Data)
+			record, err = s.GetRecord(ctx, 1)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"count": "100", "state": "NV"}, record.(*entity.PersistentRecord).Data)
+
+			// an update valid from now has no later change to end at
+			record, err = s.UpdateRecord(ctx, 1, map[string]*string{"count": &count}, UpdateOptions{})
+			require.NoError(t, err)
+			require.Empty(t, record.(*entity.PersistentRecord).ValidTo)
+		})
+	}
+}
+
+func Test_VerifyRecords(t *testing.T) {
+	ctx := context.Background()
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	s := NewPersistentRecordService(dbutils.NewStore(db))
+
+	// more versions than fit in one page, so records span page boundaries
+	total := snapshotPageSize + 100
+	for i := 0; i < total; i++ {
+		value := strconv.Itoa(i)
+		_, err = s.UpdateRecord(ctx, i%7+1, map[string]*string{"a": &value}, UpdateOptions{})
+		require.NoError(t, err)
+	}
+	_, err = db.Exec(`UPDATE records SET data = '{"a":"edited"}' WHERE id = 3 AND version = 40`)
+	require.NoError(t, err)
+
+	var results []entity.Verification
+	err = s.VerifyRecords(ctx, func(verification *entity.Verification) error {
+		results = append(results, *verification)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, results, 7)
+	versions := 0
+	for i, result := range results {
+		require.Equal(t, i+1, result.ID)
+		require.Equal(t, result.ID != 3, result.Valid)
+		versions += result.Versions
+	}
+	require.Equal(t, total, versions)
+	require.Equal(t, 40, results[2].BrokenVersion)
+}
+
+func Test_UpdateRecord_KeepsEditOfLatestVersionEvident(t *testing.T) {
+	ctx := context.Background()
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	s := NewPersistentRecordService(dbutils.NewStore(db))
+
+	value := "1"
+	_, err = s.UpdateRecord(ctx, 1, map[string]*string{"a": &value}, UpdateOptions{})
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE records SET data = '{"a":"edited"}', author = 'mallory' WHERE id = 1 AND version = 1`)
+	require.NoError(t, err)
+
+	// closing the edited version does not hash it again
+	value = "2"
+	_, err = s.UpdateRecord(ctx, 1, map[string]*string{"a": &value}, UpdateOptions{})
+	require.ErrorIs(t, err, storage.ErrHashMismatch)
+
+	verification, err := s.VerifyRecord(ctx, 1)
+	require.NoError(t, err)
+	require.False(t, verification.Valid)
+	require.Equal(t, 1, verification.BrokenVersion)
+
+	// an import continuing the edited version is rejected on its own line
+	result, err := s.ImportRecords(ctx, func(yield func(*entity.PersistentRecord, error) bool) {
+		if !yield(&entity.PersistentRecord{ID: 1, Version: 2, Start: "29990101000000000000000", Data: map[string]string{}}, nil) {
+			return
+		}
+		yield(&entity.PersistentRecord{ID: 2, Version: 1, Start: "20200101000000000000000", Data: map[string]string{}}, nil)
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Imported)
+	require.Equal(t, []entity.ImportError{{Line: 1, Error: "version 2 of record 1: " + storage.ErrHashMismatch.Error()}}, result.Errors)
+}
+
+func Test_Checkpoints(t *testing.T) {
+	ctx := context.Background()
+	db, err := dbutils.InitDB(filepath.Join(t.TempDir(), "unit-test.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	s := NewPersistentRecordService(dbutils.NewStore(db))
+	keyFile := filepath.Join(t.TempDir(), "timetravel.key")
+	_, err = LoadSigningKey(keyFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	key, err := CreateSigningKey(keyFile)
+	require.NoError(t, err)
+	_, err = CreateSigningKey(keyFile)
+	require.ErrorIs(t, err, os.ErrExist)
+	reloaded, err := LoadSigningKey(keyFile)
+	require.NoError(t, err)
+	require.Equal(t, key, reloaded)
+
+	// five versions on January 5th, two on January 6th, and one today
+	for _, row := range []dbutils.Row{
+		{ID: 1, Version: 1, Start: "20260105090000000000000", End: "20260105100000000000000", Data: []byte(`{"a":"1"}`)},
+		{ID: 1, Version: 2, Start: "20260105100000000000000", End: "20260106090000000000000", Data: []byte(`{"a":"2"}`)},
+		{ID: 2, Version: 1, Start: "20260105110000000000000", Data: []byte(`{"b":"1"}`)},
+		{ID: 3, Version: 1, Start: "20260105120000000000000", Data: []byte(`{"c":"1"}`)},
+		{ID: 4, Version: 1, Start: "20260105120000000000000", Data: []byte(`{"d":"1"}`)},
+		{ID: 1, Version: 3, Start: "20260106090000000000000", Data: []byte(`{"a":"3"}`)},
+		{ID: 5, Version: 1, Start: "20260106100000000000000", Data: []byte(`{"e":"1"}`)},
+	} {
+		row.ValidFrom = row.Start
+		require.NoError(t, dbutils.WriteVersion(db, row))
+	}
+	value := "today"
+	_, err = s.UpdateRecord(ctx, 6, map[string]*string{"f": &value}, UpdateOptions{})
+	require.NoError(t, err)
+
+	checkpoints, err := s.CreateCheckpoints(ctx, key, time.Now())
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 2)
+	require.Equal(t, "20260105", checkpoints[0].Day)
+	require.Equal(t, 5, checkpoints[0].Leaves)
+	require.Equal(t, "20260106", checkpoints[1].Day)
+
+	// checkpoints are created once
+	again, err := s.CreateCheckpoints(ctx, key, time.Now())
+	require.NoError(t, err)
+	require.Empty(t, again)
+
+	// an auditor verifies a version with its proof and the checkpoint alone
+	proof, err := s.GetInclusionProof(ctx, 4, 1)
+	require.NoError(t, err)
+	require.Equal(t, 4, proof.LeafIndex)
+	publicKey, err := hex.DecodeString(proof.Checkpoint.PublicKey)
+	require.NoError(t, err)
+	signature, err := hex.DecodeString(proof.Checkpoint.Signature)
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(publicKey, checkpointMessage(proof.Checkpoint.Day, proof.Checkpoint.Leaves, proof.Checkpoint.Root), signature))
+	require.Equal(t, hex.EncodeToString(merkleLeafHash([]byte(proof.Leaf))), proof.LeafHash)
+	var path [][]byte
+	for _, hash := range proof.Proof {
+		decoded, err := hex.DecodeString(hash)
+		require.NoError(t, err)
+		path = append(path, decoded)
+	}
+	leafHash, _ := hex.DecodeString(proof.LeafHash)
+	root, _ := hex.DecodeString(proof.Checkpoint.Root)
+	require.True(t, verifyMerkleInclusion(leafHash, proof.LeafIndex, proof.Checkpoint.Leaves, path, root))
+
+	// closing a version changes its end, which is not part of the leaf
+	_, err = s.UpdateRecord(ctx, 2, map[string]*string{"b": &value}, UpdateOptions{})
+	require.NoError(t, err)
+	_, err = s.GetInclusionProof(ctx, 2, 1)
+	require.NoError(t, err)
+
+	_, err = s.GetInclusionProof(ctx, 6, 1)
+	require.ErrorIs(t, err, ErrCheckpointDoesNotExist)
+
+	// no version can be imported into a checkpointed day
+	result, err := s.ImportRecords(ctx, func(yield func(*entity.PersistentRecord, error) bool) {
+		yield(&entity.PersistentRecord{ID: 7, Version: 1, Start: "20260105130000000000000", Data: map[string]string{}}, nil)
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, []entity.ImportError{{Line: 1, Error: "version 1 of record 7 starts on 20260105, which is already checkpointed"}}, result.Errors)
+
+	// editing a version of the day breaks its checkpoint
+	_, err = db.Exec(`UPDATE records SET data = '{"c":"edited"}' WHERE id = 3 AND version = 1`)
+	require.NoError(t, err)
+	_, err = s.GetInclusionProof(ctx, 4, 1)
+	require.ErrorIs(t, err, ErrCheckpointMismatch)
+}
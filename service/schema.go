@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+var ErrRecordTypeInvalid = errors.New("record type must start with a lowercase letter followed by lowercase letters, digits or underscores")
+var ErrSchemaDoesNotExist = errors.New("schema of that record type does not exist")
+var ErrSchemaInvalid = errors.New("schema is not a valid JSON Schema")
+
+var recordTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// ValidationError is returned when the data of a new version does not match the schema of its record type.
+type ValidationError struct {
+	RecordType    string
+	SchemaVersion int
+	Fields        []entity.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		fields[i] = field.Field + " " + field.Error
+	}
+	return fmt.Sprintf("record does not match schema %s version %d: %s", e.RecordType, e.SchemaVersion, strings.Join(fields, "; "))
+}
+
+// RegisterSchema will store the schema as the next version of the JSON Schema of the record type.
+// New versions of records of that type are validated against it; existing versions keep the schema version
+// they were validated against.
+func (s *PersistentRecordService) RegisterSchema(ctx context.Context, recordType string, schema json.RawMessage) (*entity.Schema, error) {
+	if !recordTypePattern.MatchString(recordType) {
+		return nil, ErrRecordTypeInvalid
+	}
+	if _, err := compileJSONSchema(schema); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchemaInvalid, err)
+	}
+
+	created := FormatTimestamp(time.Now())
+	version, err := s.store.AppendSchema(recordType, created, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.Schema{
+		RecordType: recordType,
+		Version:    version,
+		Created:    created,
+		Schema:     schema,
+	}, nil
+}
+
+// GetSchema will retrieve the given version of the schema of a record type, or the latest version if version is 0.
+func (s *PersistentRecordService) GetSchema(ctx context.Context, recordType string, version int) (*entity.Schema, error) {
+	row, err := s.store.ReadSchema(recordType, version)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrSchemaDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.Schema{
+		RecordType: row.RecordType,
+		Version:    row.Version,
+		Created:    row.Created,
+		Schema:     row.Schema,
+	}, nil
+}
+
+// validateRecordData checks the encoded data of a version against a version of the schema of its record type,
+// or the latest version if schemaVersion is 0, and returns the version it was checked against.
+func validateRecordData(store storage.Reader, recordType string, schemaVersion int, data []byte) (int, error) {
+	if !recordTypePattern.MatchString(recordType) {
+		return 0, ErrRecordTypeInvalid
+	}
+
+	row, err := store.ReadSchema(recordType, schemaVersion)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, ErrSchemaDoesNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	schema, err := compileJSONSchema(row.Schema)
+	if err != nil {
+		return 0, err
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return 0, err
+	}
+
+	var fields []entity.FieldError
+	schema.validate(value, "", &fields)
+	if len(fields) > 0 {
+		return 0, &ValidationError{RecordType: recordType, SchemaVersion: row.Version, Fields: fields}
+	}
+
+	return row.Version, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+var ErrSearchUnavailable = errors.New("full-text search is not available")
+var ErrSearchQueryInvalid = errors.New("search query is not valid")
+
+// SearchRecords will return at most limit versions whose data matches the full-text query, best matches first.
+// With a non-zero at only the versions current at that time are searched, otherwise every version.
+func (s *PersistentRecordService) SearchRecords(ctx context.Context, query string, at time.Time, limit int) ([]entity.SearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrSearchQueryInvalid
+	}
+
+	timestamp := ""
+	if !at.IsZero() {
+		timestamp = FormatTimestamp(at)
+	}
+
+	hits, err := s.store.Search(query, timestamp, limit)
+	if errors.Is(err, storage.ErrSearchUnavailable) {
+		return nil, ErrSearchUnavailable
+	}
+	if errors.Is(err, storage.ErrSearchQueryInvalid) {
+		return nil, ErrSearchQueryInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]entity.SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, entity.SearchResult{ID: hit.ID, Version: hit.Version, Snippet: hit.Snippet})
+	}
+	return results, nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PersistentTimeFormat is the layout of the whole seconds of a persisted timestamp.
+// It is followed by nine digits of nanoseconds, so timestamps are sub-second and still sort as strings.
+const PersistentTimeFormat = "20060102150405"
+
+const persistentTimeLength = len(PersistentTimeFormat) + 9
+
+// microsecondTimeLength is the length of the part of a persisted timestamp down to microseconds.
+const microsecondTimeLength = len(PersistentTimeFormat) + 6
+
+// FormatTimestamp formats t the way start, end and valid times of records are persisted.
+func FormatTimestamp(t time.Time) string {
+	t = t.UTC()
+	return t.Format(PersistentTimeFormat) + fmt.Sprintf("%09d", t.Nanosecond())
+}
+
+// ParseTimestamp parses a timestamp formatted by FormatTimestamp.
+func ParseTimestamp(value string) (time.Time, error) {
+	if len(value) != persistentTimeLength {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	seconds, err := time.Parse(PersistentTimeFormat, value[:len(PersistentTimeFormat)])
+	if err != nil {
+		return time.Time{}, err
+	}
+	nanos, err := strconv.Atoi(value[len(PersistentTimeFormat):])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	return seconds.Add(time.Duration(nanos)), nil
+}
+
+// nextTimestamp returns the current time, or the start of the microsecond after previous if the clock has not
+// moved past that microsecond (several writes within the clock resolution, or a system clock that stepped
+// backwards), so the versions of a record always start strictly after each other. Starts are a microsecond
+// apart at least, the resolution of PostgreSQL timestamps, so no version is current for an empty range there.
+func nextTimestamp(previous string) (time.Time, error) {
+	now := time.Now().UTC()
+	if previous == "" {
+		return now, nil
+	}
+
+	last, err := ParseTimestamp(previous)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := last.Truncate(time.Microsecond).Add(time.Microsecond)
+	if now.Before(next) {
+		return next, nil
+	}
+	return now, nil
+}
+
+// laterMicrosecond reports whether the timestamp to falls in a later microsecond than from, so that a range
+// from one to the other is not empty at the resolution of PostgreSQL timestamps.
+func laterMicrosecond(from string, to string) bool {
+	return to[:microsecondTimeLength] > from[:microsecondTimeLength]
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+// PersistentTypedRecordService serves the versions stored by PersistentRecordService with typed JSON values.
+type PersistentTypedRecordService struct {
+	store storage.Store
+}
+
+func NewPersistentTypedRecordService(store storage.Store) PersistentTypedRecordService {
+	return PersistentTypedRecordService{
+		store: store,
+	}
+}
+
+// GetRecord will retrieve the version of the record valid now, as PersistentRecordService.GetRecord does.
+func (s *PersistentTypedRecordService) GetRecord(ctx context.Context, id int) (*entity.TypedRecord, error) {
+	row, err := readCurrent(s.store, id, FormatTimestamp(time.Now()))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrRecordDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if row.Deleted {
+		return nil, ErrRecordDeleted
+	}
+
+	return typedRecordFromRow(row)
+}
+
+func (s *PersistentTypedRecordService) GetVersion(ctx context.Context, id int, version int) (*entity.TypedRecord, error) {
+	row, err := s.store.ReadVersion(id, version)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrVersionDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return typedRecordFromRow(row)
+}
+
+// ListRecords will retrieve record containing all versions.
+func (s *PersistentTypedRecordService) ListRecords(ctx context.Context, id int) (*entity.TypedRecords, error) {
+	rows, err := s.store.ReadRange(id, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrRecordDoesNotExist
+	}
+
+	output := &entity.TypedRecords{}
+	for _, row := range rows {
+		record, errRow := typedRecordFromRow(&row)
+		if errRow != nil {
+			return nil, errRow
+		}
+		output.Records = append(output.Records, *record)
+	}
+
+	return output, nil
+}
+
+// UpdateRecord will update End of last version, and add a new record with incremented version.
+// Each update replaces the whole value of its key; a JSON null deletes the key.
+func (s *PersistentTypedRecordService) UpdateRecord(ctx context.Context, id int, updates map[string]json.RawMessage, opts UpdateOptions) (*entity.TypedRecord, error) {
+	row, err := appendVersion(ctx, s.store, id, opts, func(newData map[string]json.RawMessage) error {
+		for key, value := range updates {
+			if value == nil || string(value) == "null" { // deletion update
+				delete(newData, key)
+			} else {
+				newData[key] = value
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return typedRecordFromRow(row)
+}
+
+// typedRecordFromRow decodes the stored JSON data of a row into a record with typed values.
+func typedRecordFromRow(row *storage.Row) (*entity.TypedRecord, error) {
+	data, err := decodeData(row.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.TypedRecord{
+		ID:            row.ID,
+		Version:       row.Version,
+		Start:         row.Start,
+		End:           row.End,
+		ValidFrom:     row.ValidFrom,
+		ValidTo:       row.ValidTo,
+		RecordType:    row.RecordType,
+		SchemaVersion: row.SchemaVersion,
+		Deleted:       row.Deleted,
+		Author:        row.Author,
+		Reason:        row.Reason,
+		Source:        row.Source,
+		Data:          data,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/regr76/timetravel/entity"
+	"github.com/regr76/timetravel/storage"
+)
+
+// chainVerifier checks the versions of one record, which are given to it in ascending version order.
+type chainVerifier struct {
+	result   entity.Verification
+	previous *storage.Row
+}
+
+func (v *chainVerifier) add(row storage.Row) {
+	v.result.Versions++
+	if !v.result.Valid {
+		return
+	}
+
+	previousHash := ""
+	if v.previous != nil {
+		previousHash = v.previous.Hash
+	}
+	switch {
+	case row.Version != v.result.Versions:
+		v.fail(row.Version, fmt.Sprintf("version %d follows version %d", row.Version, v.result.Versions-1))
+	case row.Hash != storage.HashVersion(row, previousHash):
+		v.fail(row.Version, fmt.Sprintf("version %d does not match its hash", row.Version))
+	}
+	v.result.Hash = row.Hash
+	v.previous = &row
+}
+
+func (v *chainVerifier) fail(version int, message string) {
+	v.result.Valid = false
+	v.result.BrokenVersion = version
+	v.result.Error = message
+}
+
+func newChainVerifier(id int) *chainVerifier {
+	return &chainVerifier{result: entity.Verification{ID: id, Valid: true}}
+}
+
+// VerifyRecord will check that the stored versions of the record still form the hash chain they were written with.
+func (s *PersistentRecordService) VerifyRecord(ctx context.Context, id int) (*entity.Verification, error) {
+	rows, err := s.store.ReadRange(id, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrRecordDoesNotExist
+	}
+
+	verifier := newChainVerifier(id)
+	for _, row := range rows {
+		verifier.add(row)
+	}
+	return &verifier.result, nil
+}
+
+// VerifyRecords will check the hash chain of every record and call fn, in ascending id order, with the result
+// for each record. Versions are read page by page, so memory stays flat however large the store is.
+func (s *PersistentRecordService) VerifyRecords(ctx context.Context, fn func(verification *entity.Verification) error) error {
+	var verifier *chainVerifier
+	afterID, afterVersion := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rows, err := s.store.Scan(storage.RowFilter{}, afterID, afterVersion, snapshotPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if verifier != nil && verifier.result.ID != row.ID {
+				if err := fn(&verifier.result); err != nil {
+					return err
+				}
+				verifier = nil
+			}
+			if verifier == nil {
+				verifier = newChainVerifier(row.ID)
+			}
+			verifier.add(row)
+			afterID, afterVersion = row.ID, row.Version
+		}
+
+		if len(rows) < snapshotPageSize {
+			if verifier != nil {
+				return fn(&verifier.result)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// HashVersion returns the hex SHA-256 hash of every stored field of the row but the hash itself, and of the
+// hash of the previous version of the record (empty for the first version). Each version thereby vouches
+// for the whole history before it: editing, inserting or removing a stored version breaks the chain.
+func HashVersion(row Row, previousHash string) string {
+	// a JSON array keeps the fields apart whatever they contain
+	encoded, _ := json.Marshal([]any{row.ID, row.Version, row.Start, row.End, row.ValidFrom, row.ValidTo, string(row.Data),
+		row.RecordType, row.SchemaVersion, row.Deleted, row.Author, row.Reason, row.Source, previousHash})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// LeafData returns the bytes a version contributes to the Merkle tree of the day it was written: its id,
+// version, start, valid time, data, type and change metadata as a JSON array. Unlike HashVersion it leaves
+// out end, which is set when the version is superseded, so the leaf never changes once written.
+func LeafData(row Row) []byte {
+	encoded, _ := json.Marshal([]any{row.ID, row.Version, row.Start, row.ValidFrom, row.ValidTo, string(row.Data),
+		row.RecordType, row.SchemaVersion, row.Deleted, row.Author, row.Reason, row.Source})
+	return encoded
+}
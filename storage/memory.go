@@ -0,0 +1,478 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// dayLength is the length of the YYYYMMDD prefix of a timestamp that names its day.
+const dayLength = 8
+
+// MemoryStore is a Store that keeps the versions in memory, for tests that should not touch disk.
+// It has no full-text index, so Search returns ErrSearchUnavailable.
+type MemoryStore struct {
+	mu    sync.Mutex
+	state *memoryState
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: newMemoryState()}
+}
+
+// memoryState holds the versions of each record in ascending version order,
+// the schema versions of each record type in ascending version order, and the checkpoints by day.
+type memoryState struct {
+	records     map[int][]Row
+	schemas     map[string][]SchemaRow
+	checkpoints map[string]CheckpointRow
+}
+
+func newMemoryState() *memoryState {
+	return &memoryState{
+		records:     map[int][]Row{},
+		schemas:     map[string][]SchemaRow{},
+		checkpoints: map[string]CheckpointRow{},
+	}
+}
+
+// clone copies the state for a transaction. Rows are copied by value; their data is never modified in place.
+func (m *memoryState) clone() *memoryState {
+	output := newMemoryState()
+	for id, rows := range m.records {
+		output.records[id] = slices.Clone(rows)
+	}
+	for recordType, rows := range m.schemas {
+		output.schemas[recordType] = slices.Clone(rows)
+	}
+	for day, row := range m.checkpoints {
+		output.checkpoints[day] = row
+	}
+	return output
+}
+
+// memoryTx reads and writes the state of a MemoryStore, or the copy of it made for a transaction.
+type memoryTx struct {
+	state *memoryState
+}
+
+// Update runs fn on a copy of the state, which replaces the state if fn succeeds.
+func (s *MemoryStore) Update(ctx context.Context, fn func(tx Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{state: s.state.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.state = tx.state
+	return nil
+}
+
+// view runs fn on the current state; writes outside Update take effect at once.
+func (s *MemoryStore) view(fn func(tx *memoryTx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fn(&memoryTx{state: s.state})
+}
+
+func (s *MemoryStore) ReadLatest(id int) (row *Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		row, err = tx.ReadLatest(id)
+		return err
+	})
+	return row, err
+}
+
+func (s *MemoryStore) ReadVersion(id int, version int) (row *Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		row, err = tx.ReadVersion(id, version)
+		return err
+	})
+	return row, err
+}
+
+func (s *MemoryStore) ReadAt(id int, at string) (row *Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		row, err = tx.ReadAt(id, at)
+		return err
+	})
+	return row, err
+}
+
+func (s *MemoryStore) ReadAsOf(id int, knownAt string, validAt string) (row *Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		row, err = tx.ReadAsOf(id, knownAt, validAt)
+		return err
+	})
+	return row, err
+}
+
+func (s *MemoryStore) ReadRange(id int, fromVersion int, toVersion int) (rows []Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		rows, err = tx.ReadRange(id, fromVersion, toVersion)
+		return err
+	})
+	return rows, err
+}
+
+func (s *MemoryStore) ScanCurrent(at string, filters []DataFilter, afterID int, limit int) (rows []Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		rows, err = tx.ScanCurrent(at, filters, afterID, limit)
+		return err
+	})
+	return rows, err
+}
+
+func (s *MemoryStore) Scan(filter RowFilter, afterID int, afterVersion int, limit int) (rows []Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		rows, err = tx.Scan(filter, afterID, afterVersion, limit)
+		return err
+	})
+	return rows, err
+}
+
+func (s *MemoryStore) ReadDay(day string) (rows []Row, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		rows, err = tx.ReadDay(day)
+		return err
+	})
+	return rows, err
+}
+
+func (s *MemoryStore) ReadSchema(recordType string, version int) (row *SchemaRow, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		row, err = tx.ReadSchema(recordType, version)
+		return err
+	})
+	return row, err
+}
+
+func (s *MemoryStore) ReadCheckpoint(day string) (row *CheckpointRow, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		row, err = tx.ReadCheckpoint(day)
+		return err
+	})
+	return row, err
+}
+
+func (s *MemoryStore) ReadDaysWithoutCheckpoint(before string) (days []string, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		days, err = tx.ReadDaysWithoutCheckpoint(before)
+		return err
+	})
+	return days, err
+}
+
+func (s *MemoryStore) Search(query string, at string, limit int) ([]SearchHit, error) {
+	return nil, ErrSearchUnavailable
+}
+
+func (s *MemoryStore) Append(row Row) error {
+	return s.view(func(tx *memoryTx) error {
+		return tx.Append(row)
+	})
+}
+
+func (s *MemoryStore) CloseVersion(id int, version int, end string) error {
+	return s.view(func(tx *memoryTx) error {
+		return tx.CloseVersion(id, version, end)
+	})
+}
+
+func (s *MemoryStore) AppendSchema(recordType string, created string, schema []byte) (version int, err error) {
+	err = s.view(func(tx *memoryTx) error {
+		version, err = tx.AppendSchema(recordType, created, schema)
+		return err
+	})
+	return version, err
+}
+
+func (s *MemoryStore) WriteCheckpoint(row CheckpointRow) error {
+	return s.view(func(tx *memoryTx) error {
+		return tx.WriteCheckpoint(row)
+	})
+}
+
+// Savepoint restores the state from before fn if fn fails.
+func (tx *memoryTx) Savepoint(fn func() error) error {
+	saved := tx.state.clone()
+	if err := fn(); err != nil {
+		tx.state = saved
+		return err
+	}
+	return nil
+}
+
+func (tx *memoryTx) ReadLatest(id int) (*Row, error) {
+	rows := tx.state.records[id]
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	row := rows[len(rows)-1]
+	return &row, nil
+}
+
+func (tx *memoryTx) ReadVersion(id int, version int) (*Row, error) {
+	rows := tx.state.records[id]
+	if version < 1 || version > len(rows) {
+		return nil, ErrNotFound
+	}
+	row := rows[version-1]
+	return &row, nil
+}
+
+// latestWhere returns the latest version of the record matching the predicate.
+func (tx *memoryTx) latestWhere(id int, match func(row *Row) bool) (*Row, error) {
+	rows := tx.state.records[id]
+	for i := len(rows) - 1; i >= 0; i-- {
+		if match(&rows[i]) {
+			row := rows[i]
+			return &row, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (tx *memoryTx) ReadAt(id int, at string) (*Row, error) {
+	return tx.latestWhere(id, func(row *Row) bool {
+		return row.Start <= at && (row.End == "" || row.End > at)
+	})
+}
+
+func (tx *memoryTx) ReadAsOf(id int, knownAt string, validAt string) (*Row, error) {
+	return tx.latestWhere(id, func(row *Row) bool {
+		return row.Start <= knownAt && row.ValidFrom <= validAt && (row.ValidTo == "" || row.ValidTo > validAt)
+	})
+}
+
+func (tx *memoryTx) ReadRange(id int, fromVersion int, toVersion int) ([]Row, error) {
+	rows := tx.state.records[id]
+	if toVersion == 0 || toVersion > len(rows) {
+		toVersion = len(rows)
+	}
+	fromVersion = max(fromVersion, 1)
+	if fromVersion > toVersion {
+		return nil, nil
+	}
+	return slices.Clone(rows[fromVersion-1 : toVersion]), nil
+}
+
+func (tx *memoryTx) ScanCurrent(at string, filters []DataFilter, afterID int, limit int) ([]Row, error) {
+	for _, filter := range filters {
+		if filter.Key == "" || strings.Contains(filter.Key, `"`) {
+			return nil, ErrDataKeyInvalid
+		}
+	}
+
+	var output []Row
+	for _, id := range tx.ids() {
+		if id <= afterID {
+			continue
+		}
+		if len(output) == limit {
+			break
+		}
+		row, err := tx.ReadAt(id, at)
+		if errors.Is(err, ErrNotFound) || row.Deleted {
+			continue
+		}
+		matches, err := matchesData(row.Data, filters)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			output = append(output, *row)
+		}
+	}
+	return output, nil
+}
+
+// matchesData reports whether the data has the value of every filter. Values are compared as v2 shows them,
+// as in the SQL stores: strings as they are, other values as their JSON text.
+func matchesData(data []byte, filters []DataFilter) (bool, error) {
+	if len(filters) == 0 {
+		return true, nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return false, err
+	}
+	for _, filter := range filters {
+		value, ok := values[filter.Key]
+		if !ok {
+			return false, nil
+		}
+		var text string
+		if err := json.Unmarshal(value, &text); err != nil {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, value); err != nil {
+				return false, err
+			}
+			text = compact.String()
+		}
+		if text != filter.Value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (tx *memoryTx) Scan(filter RowFilter, afterID int, afterVersion int, limit int) ([]Row, error) {
+	var output []Row
+	for _, id := range tx.ids() {
+		if id < afterID || (filter.FromID > 0 && id < filter.FromID) || (filter.ToID > 0 && id > filter.ToID) {
+			continue
+		}
+		for _, row := range tx.state.records[id] {
+			if len(output) == limit {
+				return output, nil
+			}
+			if id == afterID && row.Version <= afterVersion {
+				continue
+			}
+			if filter.Since != "" && row.End != "" && row.End <= filter.Since {
+				continue
+			}
+			if filter.Until != "" && row.Start >= filter.Until {
+				continue
+			}
+			output = append(output, row)
+		}
+	}
+	return output, nil
+}
+
+func (tx *memoryTx) ReadDay(day string) ([]Row, error) {
+	var output []Row
+	for _, rows := range tx.state.records {
+		for _, row := range rows {
+			if strings.HasPrefix(row.Start, day) {
+				output = append(output, row)
+			}
+		}
+	}
+	slices.SortFunc(output, func(a, b Row) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(a.ID, b.ID), cmp.Compare(a.Version, b.Version))
+	})
+	return output, nil
+}
+
+func (tx *memoryTx) ReadSchema(recordType string, version int) (*SchemaRow, error) {
+	rows := tx.state.schemas[recordType]
+	if version == 0 {
+		version = len(rows)
+	}
+	if version < 1 || version > len(rows) {
+		return nil, ErrNotFound
+	}
+	row := rows[version-1]
+	return &row, nil
+}
+
+func (tx *memoryTx) ReadCheckpoint(day string) (*CheckpointRow, error) {
+	row, ok := tx.state.checkpoints[day]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &row, nil
+}
+
+func (tx *memoryTx) ReadDaysWithoutCheckpoint(before string) ([]string, error) {
+	days := map[string]bool{}
+	for _, rows := range tx.state.records {
+		for _, row := range rows {
+			day := row.Start[:dayLength]
+			if _, checkpointed := tx.state.checkpoints[day]; row.Start < before && !checkpointed {
+				days[day] = true
+			}
+		}
+	}
+	output := make([]string, 0, len(days))
+	for day := range days {
+		output = append(output, day)
+	}
+	slices.Sort(output)
+	return output, nil
+}
+
+func (tx *memoryTx) Search(query string, at string, limit int) ([]SearchHit, error) {
+	return nil, ErrSearchUnavailable
+}
+
+func (tx *memoryTx) Append(row Row) error {
+	rows := tx.state.records[row.ID]
+	if len(rows) != row.Version-1 {
+		return ErrVersionConflict
+	}
+
+	previousHash := ""
+	if len(rows) > 0 {
+		previousHash = rows[len(rows)-1].Hash
+	}
+	row.Data = slices.Clone(row.Data)
+	row.Hash = HashVersion(row, previousHash)
+	tx.state.records[row.ID] = append(rows, row)
+	return nil
+}
+
+func (tx *memoryTx) CloseVersion(id int, version int, end string) error {
+	rows := tx.state.records[id]
+	if version < 1 || version > len(rows) {
+		return nil
+	}
+
+	previousHash := ""
+	if version > 1 {
+		previousHash = rows[version-2].Hash
+	}
+	row := &rows[version-1]
+	if row.Hash != HashVersion(*row, previousHash) {
+		return ErrHashMismatch
+	}
+	row.End = end
+	row.Hash = HashVersion(*row, previousHash)
+	return nil
+}
+
+func (tx *memoryTx) AppendSchema(recordType string, created string, schema []byte) (int, error) {
+	rows := tx.state.schemas[recordType]
+	version := len(rows) + 1
+	tx.state.schemas[recordType] = append(rows, SchemaRow{
+		RecordType: recordType,
+		Version:    version,
+		Created:    created,
+		Schema:     slices.Clone(schema),
+	})
+	return version, nil
+}
+
+func (tx *memoryTx) WriteCheckpoint(row CheckpointRow) error {
+	if _, ok := tx.state.checkpoints[row.Day]; ok {
+		return ErrCheckpointExists
+	}
+	tx.state.checkpoints[row.Day] = row
+	return nil
+}
+
+// ids returns the ids of the stored records in ascending order.
+func (tx *memoryTx) ids() []int {
+	ids := make([]int, 0, len(tx.state.records))
+	for id := range tx.state.records {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,158 @@
+// Package storage defines the versioned store the record services are built on. A store keeps every version
+// of every record, append-only: a version is written once and later only closed, when the next version of
+// its record is appended. dbutils provides the SQLite adapter; MemoryStore keeps the versions in memory.
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when the version, schema or checkpoint read does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrVersionConflict is returned by Append when the record no longer is at the preceding version.
+var ErrVersionConflict = errors.New("record is no longer at the preceding version")
+
+// ErrDataKeyInvalid is returned for a data key that cannot be expressed as a JSON path.
+var ErrDataKeyInvalid = errors.New("data key must not be empty or contain a double quote")
+
+// ErrSearchUnavailable is returned by Search of stores without a full-text index.
+var ErrSearchUnavailable = errors.New("full-text search is not available")
+
+// ErrSearchQueryInvalid is returned for a query the full-text index cannot parse.
+var ErrSearchQueryInvalid = errors.New("search query is not valid")
+
+// ErrHashMismatch is returned by CloseVersion when the stored version no longer matches its hash, as it was
+// edited outside of the store. Computing the hash again would hide the edit.
+var ErrHashMismatch = errors.New("stored version does not match its hash")
+
+// ErrCheckpointExists is returned by WriteCheckpoint when the day already has a checkpoint.
+var ErrCheckpointExists = errors.New("day already has a checkpoint")
+
+// Row is one stored version of a record. Data holds the JSON object of the version.
+// Start/End are the transaction time (when the version was recorded and superseded),
+// ValidFrom/ValidTo the valid time supplied by the caller; all are timestamps as formatted by the service.
+type Row struct {
+	ID            int
+	Version       int
+	Start         string
+	End           string
+	ValidFrom     string
+	ValidTo       string
+	Data          []byte
+	RecordType    string
+	SchemaVersion int
+	Deleted       bool
+	Author        string
+	Reason        string
+	Source        string
+	Hash          string
+}
+
+// RowFilter restricts the rows read by Scan; zero values do not filter.
+type RowFilter struct {
+	FromID int    // smallest id, inclusive
+	ToID   int    // largest id, inclusive
+	Since  string // only versions that were still current at or after Since
+	Until  string // only versions that started before Until
+}
+
+// DataFilter matches versions whose data has the value at the key.
+type DataFilter struct {
+	Key   string
+	Value string
+}
+
+// SchemaRow is one stored version of the JSON Schema of a record type.
+type SchemaRow struct {
+	RecordType string
+	Version    int
+	Created    string
+	Schema     []byte
+}
+
+// CheckpointRow is the stored checkpoint of a day. Root, Signature and PublicKey are hex encoded.
+type CheckpointRow struct {
+	Day       string
+	Leaves    int
+	Root      string
+	Created   string
+	Signature string
+	PublicKey string
+}
+
+// SearchHit is a version whose data matched a full-text query, with an extract of the matching text,
+// escaped as HTML, in which the matched terms are enclosed in <mark> and </mark>.
+type SearchHit struct {
+	ID      int
+	Version int
+	Snippet string
+}
+
+// Reader reads versions, schemas and checkpoints. Reads of a single item return ErrNotFound if it does not exist.
+type Reader interface {
+	// ReadLatest reads the latest version of the record.
+	ReadLatest(id int) (*Row, error)
+	// ReadVersion reads one version of the record.
+	ReadVersion(id int, version int) (*Row, error)
+	// ReadAt reads the version of the record that was current at the given time.
+	ReadAt(id int, at string) (*Row, error)
+	// ReadAsOf reads the most recently recorded version, as known at knownAt, whose validity covers validAt.
+	ReadAsOf(id int, knownAt string, validAt string) (*Row, error)
+	// ReadRange reads the versions from fromVersion to toVersion (both inclusive) of the record in ascending
+	// order; a toVersion of 0 reads up to the latest version. A record without versions has an empty range.
+	ReadRange(id int, fromVersion int, toVersion int) ([]Row, error)
+	// ScanCurrent reads a page of at most limit versions that were current at the given time and match every
+	// filter, one per record, for records with an id greater than afterID in ascending id order.
+	// Records that were deleted at that time are left out.
+	ScanCurrent(at string, filters []DataFilter, afterID int, limit int) ([]Row, error)
+	// Scan reads a page of at most limit versions matching the filter that come after the
+	// (afterID, afterVersion) cursor, in ascending (id, version) order.
+	Scan(filter RowFilter, afterID int, afterVersion int, limit int) ([]Row, error)
+	// ReadDay reads the versions that started on the day (YYYYMMDD) ordered by start, then id and version.
+	ReadDay(day string) ([]Row, error)
+	// ReadSchema reads a version of the schema of a record type, or the latest version if version is 0.
+	ReadSchema(recordType string, version int) (*SchemaRow, error)
+	// ReadCheckpoint reads the checkpoint of a day.
+	ReadCheckpoint(day string) (*CheckpointRow, error)
+	// ReadDaysWithoutCheckpoint reads, in ascending order, the days before the given day on which versions
+	// started that have no checkpoint yet.
+	ReadDaysWithoutCheckpoint(before string) ([]string, error)
+	// Search reads at most limit versions whose data matches the full-text query, best matches first.
+	// With a non-empty at, only the versions current at that time are searched. Tombstones are never matched.
+	Search(query string, at string, limit int) ([]SearchHit, error)
+}
+
+// Writer appends versions and stores schemas and checkpoints.
+type Writer interface {
+	// Append writes the version, chained to the previous version of the record, only if the latest stored
+	// version of the record is version-1 (or the record does not exist yet for version 1); otherwise it
+	// returns ErrVersionConflict. The hash of the row is computed by the store.
+	Append(row Row) error
+	// CloseVersion sets the end of a version and computes its hash again. Only the latest version of a record is
+	// closed, so no later version depends on the old hash. It returns ErrHashMismatch if the version does not
+	// match its hash before it is closed, and ErrVersionConflict if another writer added a version first.
+	CloseVersion(id int, version int, end string) error
+	// AppendSchema stores a schema as the next version of the record type and returns that version.
+	AppendSchema(recordType string, created string, schema []byte) (int, error)
+	// WriteCheckpoint stores the checkpoint of a day, which is never replaced.
+	WriteCheckpoint(row CheckpointRow) error
+}
+
+// Tx is a store within a transaction.
+type Tx interface {
+	Reader
+	Writer
+	// Savepoint runs fn so that, if fn fails, only the writes of fn are undone and the transaction stays usable.
+	Savepoint(fn func() error) error
+}
+
+// Store is a versioned record store. Its reads and writes outside Update each stand on their own.
+type Store interface {
+	Reader
+	Writer
+	// Update runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise.
+	// fn must only use the Tx it is given.
+	Update(ctx context.Context, fn func(tx Tx) error) error
+}